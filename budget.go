@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultPromptBudget is the default size limit of a continuation prompt,
+// in estimated tokens.
+const defaultPromptBudget = 16000
+
+// estimateTokens approximates the number of tokens in s at four bytes per
+// token, which is close for English text and code.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// promptBudget limits the size of the continuation prompt. Parts that do
+// not fit are cut, and their full text is saved to Dir.
+type promptBudget struct {
+	Tokens int    // 0 = unlimited
+	Dir    string // where the full text of cut parts is saved
+}
+
+// budgetPart is one cuttable part of the continuation prompt.
+type budgetPart struct {
+	name string // used in the saved file name, e.g. "git-status"
+	keep int    // tokens the part is never cut below
+	text *string
+}
+
+// budgetParts lists the parts of d in the order they are cut: git state
+// first, then the less important handoff sections and the ledger, then Q2,
+// and the task, Q0 and Q1 last. The handoff parts point into h, whose text
+// goes back into d.PreviousHandoff after a cut.
+func budgetParts(d *promptData, h *parsedHandoff) []budgetPart {
+	parts := []budgetPart{
+		{"git-status", 0, &d.GitStatus},
+		{"run-commits", 0, &d.RunCommits},
+		{"run-diff", 0, &d.RunDiff},
+		{"session-diff", 0, &d.SessionDiff},
+	}
+	if len(h.Sections) == 0 || len(h.Missing) > 0 {
+		// Not split into sections, so it is kept like Q0 and Q1.
+		return append(parts,
+			budgetPart{"ledger", 0, &d.Ledger},
+			budgetPart{"plan", 200, &d.Plan},
+			budgetPart{"handoff", 500, &d.PreviousHandoff},
+			budgetPart{"task", 500, &d.Task},
+		)
+	}
+	section := func(id string, keep int) []budgetPart {
+		if s := h.section(id); s != nil {
+			return []budgetPart{{strings.ToLower(id), keep, &s.Body}}
+		}
+		return nil
+	}
+	for i := range h.Sections {
+		if s := &h.Sections[i]; !isKnownSection(s.ID) {
+			parts = append(parts, budgetPart{"section-" + strings.ToLower(s.ID), 0, &s.Body})
+		}
+	}
+	parts = append(parts, budgetPart{"preamble", 0, &h.Preamble})
+	parts = append(parts, section("Q4", 0)...)
+	parts = append(parts, section("Q3", 0)...)
+	parts = append(parts, budgetPart{"ledger", 0, &d.Ledger})
+	parts = append(parts, section("Q2", 200)...)
+	parts = append(parts, budgetPart{"plan", 200, &d.Plan})
+	parts = append(parts, section("Q1", 300)...)
+	parts = append(parts, section("Q0", 300)...)
+	return append(parts, budgetPart{"task", 500, &d.Task})
+}
+
+// fit cuts parts, in order, until render's output is within the budget.
+// It returns the names of the parts it cut.
+func (b promptBudget) fit(session int, parts []budgetPart, render func() (string, error)) ([]string, error) {
+	if b.Tokens <= 0 {
+		return nil, nil
+	}
+	var cut []string
+	for _, p := range parts {
+		out, err := render()
+		if err != nil {
+			return cut, err
+		}
+		if estimateTokens(out) <= b.Tokens {
+			break
+		}
+		// Sized in bytes, so that rounding each part to tokens cannot
+		// leave the prompt a token over.
+		over := len(out) - b.Tokens*4
+		full := *p.text
+		if len(full) <= p.keep*4 {
+			continue
+		}
+		saved := b.save(session, p.name, full)
+		lines := len(splitLines(full))
+		note := "\n" + budgetNote(lines, lines, saved)
+		*p.text = cutText(full, max(len(full)-over-len(note), p.keep*4), saved)
+		cut = append(cut, p.name)
+	}
+	return cut, nil
+}
+
+// save writes the full text of a cut part to the budget directory,
+// returning its path, or "" if it could not be saved.
+func (b promptBudget) save(session int, name, text string) string {
+	if b.Dir == "" {
+		return ""
+	}
+	path := filepath.Join(b.Dir, fmt.Sprintf("s%d-%s.txt", session, name))
+	if err := os.WriteFile(path, []byte(text+"\n"), 0600); err != nil {
+		return ""
+	}
+	return path
+}
+
+// cutText keeps at most n bytes of s, ending at a line break where one
+// is close, and notes what was cut and where the full text is.
+func cutText(s string, n int, saved string) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	kept := s[:n]
+	if i := strings.LastIndexByte(kept, '\n'); i > n/2 {
+		kept = kept[:i]
+	}
+	kept = strings.TrimRight(kept, " \t\n")
+	note := budgetNote(len(splitLines(kept)), len(splitLines(s)), saved)
+	if kept == "" {
+		return note
+	}
+	return kept + "\n" + note
+}
+
+// budgetNote tells the agent a part was cut and where to read all of it.
+func budgetNote(shown, total int, saved string) string {
+	where := "the full text could not be saved"
+	if saved != "" {
+		where = "full text: " + saved
+	}
+	return fmt.Sprintf("[cut to fit the prompt budget: %d of %d lines shown; %s]", shown, total, where)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCutText(t *testing.T) {
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %02d of the text", i)
+	}
+	s := strings.Join(lines, "\n")
+
+	t.Run("keeps short text", func(t *testing.T) {
+		if got := cutText("short", 40, "/saved"); got != "short" {
+			t.Errorf("cutText = %q, want it unchanged", got)
+		}
+	})
+
+	t.Run("cuts at a line break and notes it", func(t *testing.T) {
+		got := cutText(s, 200, "/tmp/run/s2-git-status.txt")
+		kept, note, _ := strings.Cut(got, "\n[")
+		if !strings.HasSuffix(kept, "of the text") {
+			t.Errorf("cut mid-line: %q", kept)
+		}
+		if len(kept) > 200 {
+			t.Errorf("kept %d bytes, want at most 200", len(kept))
+		}
+		want := fmt.Sprintf("%d of 100 lines shown; full text: /tmp/run/s2-git-status.txt]", len(splitLines(kept)))
+		if !strings.HasSuffix(note, want) {
+			t.Errorf("note = %q, want suffix %q", note, want)
+		}
+	})
+
+	t.Run("keeps only the note at zero", func(t *testing.T) {
+		got := cutText(s, 0, "")
+		if got != "[cut to fit the prompt budget: 0 of 100 lines shown; the full text could not be saved]" {
+			t.Errorf("cutText = %q", got)
+		}
+	})
+
+	t.Run("cuts on a rune boundary", func(t *testing.T) {
+		got := cutText(strings.Repeat("é", 100), 20, "")
+		if !strings.HasPrefix(got, strings.Repeat("é", 10)+"\n[") {
+			t.Errorf("cutText = %q", got)
+		}
+	})
+}
+
+func TestBuildContinuationPromptBudget(t *testing.T) {
+	long := func(prefix string, n int) string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("%s %d", prefix, i)
+		}
+		return strings.Join(lines, "\n")
+	}
+	handoff := "## Q0: State\n" + long("state", 20) +
+		"\n\n## Q1: Next\nrun the tests\n\n## Q2: Dead ends\n" + long("dead end", 400) +
+		"\n\n## Q3: Decisions\n" + long("decision", 400)
+
+	build := func(t *testing.T, tokens int) (string, []string, string) {
+		t.Helper()
+		dir := t.TempDir()
+		d := newPromptData(3, 0, "the task")
+		d.GitRepo = true
+		d.GitStatus = long(" M file", 2000)
+		d.setBudget(tokens, dir)
+		got, cut, err := buildContinuationPrompt(testTemplates(t), d, handoff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got, cut, dir
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		got, cut, _ := build(t, 0)
+		if len(cut) > 0 || !strings.Contains(got, " M file 1999") || !strings.Contains(got, "decision 399") {
+			t.Errorf("cut %v with no budget", cut)
+		}
+	})
+
+	t.Run("cuts git state first", func(t *testing.T) {
+		got, cut, dir := build(t, 8000)
+		if strings.Join(cut, ",") != "git-status" {
+			t.Fatalf("cut = %v, want only git-status", cut)
+		}
+		if estimateTokens(got) > 8000 {
+			t.Errorf("prompt is %d tokens, budget 8000", estimateTokens(got))
+		}
+		if !strings.Contains(got, "decision 399") || !strings.Contains(got, "dead end 399") {
+			t.Error("handoff was cut")
+		}
+		saved := filepath.Join(dir, "s3-git-status.txt")
+		if !strings.Contains(got, "full text: "+saved) {
+			t.Errorf("prompt does not point to %s", saved)
+		}
+		data, err := os.ReadFile(saved)
+		if err != nil || !strings.Contains(string(data), " M file 1999") {
+			t.Errorf("full git status not saved: %v", err)
+		}
+	})
+
+	t.Run("then Q3, then Q2", func(t *testing.T) {
+		got, cut, _ := build(t, 1500)
+		if strings.Join(cut, ",") != "git-status,q3,q2" {
+			t.Fatalf("cut = %v, want git-status,q3,q2", cut)
+		}
+		if estimateTokens(got) > 1500 {
+			t.Errorf("prompt is %d tokens, budget 1500", estimateTokens(got))
+		}
+		for _, want := range []string{"the task", "state 19", "run the tests", "dead end 0"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("prompt lost %q", want)
+			}
+		}
+	})
+}
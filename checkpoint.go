@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkpointIdentity authors checkpoint commits, so that checkpoints work
+// without a configured git identity and are easy to tell apart.
+var checkpointIdentity = []string{
+	"GIT_AUTHOR_NAME=icc", "GIT_AUTHOR_EMAIL=icc@localhost",
+	"GIT_COMMITTER_NAME=icc", "GIT_COMMITTER_EMAIL=icc@localhost",
+}
+
+// checkpointRefPrefix is where the checkpoints of a run are stored.
+func checkpointRefPrefix(runID string) string {
+	return "refs/icc/" + runID + "/"
+}
+
+// checkpointRef names the checkpoint taken after session n.
+func checkpointRef(runID string, n int) string {
+	return fmt.Sprintf("%ss%d", checkpointRefPrefix(runID), n)
+}
+
+// validCheckpointRef reports whether git accepts the run's ref names.
+func validCheckpointRef(runID string) bool {
+	_, err := gitEnv(nil, "check-ref-format", checkpointRef(runID, 1))
+	return err == nil
+}
+
+// checkpointMessage is the commit message of a session checkpoint: the
+// handoff's Q0 when there is one, otherwise the session outcome.
+func checkpointMessage(runID string, rec sessionRecord) string {
+	subject := fmt.Sprintf("icc %s s%d: %s", runID, rec.Number, rec.Outcome)
+	if rec.Reason != "" {
+		subject += " (" + rec.Reason + ")"
+	}
+	q0 := ""
+	if rec.Handoff != nil {
+		q0 = rec.Handoff.answer("Q0")
+	}
+	if q0 == "" {
+		return subject
+	}
+	first := strings.TrimSpace(strings.TrimLeft(splitLines(q0)[0], "-*# "))
+	return fmt.Sprintf("icc %s s%d: %s\n\n%s", runID, rec.Number, truncateText(first, 72), q0)
+}
+
+// leftOutHeader starts the list of files a checkpoint commit message
+// names as not included.
+var leftOutHeader = fmt.Sprintf("Not included (untracked, over %d MiB):", maxUntrackedSnapshotSize>>20)
+
+// checkpointLeftOut returns the files the checkpoint commit's message
+// names as not included.
+func checkpointLeftOut(commit string) []string {
+	_, list, ok := strings.Cut(runGit("log", "-1", "--format=%B", commit), leftOutHeader+"\n")
+	if !ok {
+		return nil
+	}
+	var paths []string
+	for _, line := range splitLines(list) {
+		if path, ok := strings.CutPrefix(line, "- "); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// createCheckpoint commits the working tree to ref without touching HEAD,
+// the index or any branch. parent is the previous checkpoint, or HEAD for
+// the first one ("" in a repository without commits).
+func createCheckpoint(ref, parent, message string) (string, error) {
+	snap := takeGitSnapshot()
+	if snap == nil {
+		return "", fmt.Errorf("not a git repository")
+	}
+	if parent == "" {
+		parent = snap.Head
+	}
+	if len(snap.Skipped) > 0 {
+		message += "\n\n" + leftOutHeader + "\n- " + strings.Join(snap.Skipped, "\n- ")
+	}
+	args := []string{"commit-tree", snap.Tree, "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := gitEnv(checkpointIdentity, args...)
+	if err != nil {
+		return "", err
+	}
+	if _, err := gitEnv(nil, "update-ref", ref, commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// checkpointSession stores the working tree after a session as
+// refs/icc/<run>/s<N> and returns the commit, or "" after logging a failure.
+func checkpointSession(run *runManifest, rec sessionRecord) string {
+	parent := ""
+	for _, s := range run.Sessions {
+		if s.Checkpoint != "" {
+			parent = s.Checkpoint
+		}
+	}
+	ref := checkpointRef(run.ID, rec.Number)
+	commit, err := createCheckpoint(ref, parent, checkpointMessage(run.ID, rec))
+	if err != nil {
+		errMsg("Checkpoint failed: %v", err)
+		return ""
+	}
+	logMsg("Checkpoint %s (%s)", ref, shortHash(commit))
+	if leftOut := checkpointLeftOut(commit); len(leftOut) > 0 {
+		errMsg("Not in checkpoint %s, so not restorable from it (untracked, over %d MiB): %s",
+			ref, maxUntrackedSnapshotSize>>20, strings.Join(leftOut, ", "))
+	}
+	return commit
+}
+
+func shortHash(commit string) string {
+	if len(commit) > 10 {
+		return commit[:10]
+	}
+	return commit
+}
+
+// checkpoint is a stored snapshot of a run.
+type checkpoint struct {
+	Name    string // "s3", or "pre-restore-..." for the state saved by a restore
+	Commit  string
+	Date    string
+	Subject string
+}
+
+// listCheckpoints returns the checkpoints of a run, session checkpoints
+// first in session order.
+func listCheckpoints(runID string) []checkpoint {
+	out := runGit("for-each-ref", "--format=%(refname)%09%(objectname)%09%(creatordate:format:%Y-%m-%d %H:%M)%09%(subject)", checkpointRefPrefix(runID))
+	var cps []checkpoint
+	for _, line := range splitLines(out) {
+		f := strings.SplitN(line, "\t", 4)
+		if len(f) < 4 {
+			continue
+		}
+		cps = append(cps, checkpoint{strings.TrimPrefix(f[0], checkpointRefPrefix(runID)), f[1], f[2], f[3]})
+	}
+	sort.SliceStable(cps, func(i, j int) bool {
+		a, aok := sessionOf(cps[i].Name)
+		b, bok := sessionOf(cps[j].Name)
+		if aok != bok {
+			return aok
+		}
+		if aok {
+			return a < b
+		}
+		return cps[i].Name < cps[j].Name
+	})
+	return cps
+}
+
+// sessionOf parses a session checkpoint name, "s3" → 3.
+func sessionOf(name string) (int, bool) {
+	if !strings.HasPrefix(name, "s") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[1:])
+	return n, err == nil
+}
+
+// restoreCheckpoint makes the working tree match commit: files in it are
+// written, and files added since (tracked or untracked, not ignored) are
+// removed. HEAD, the index and branches are left alone. It returns the
+// number of files written and removed, and the large untracked files left
+// as they are because the checkpoint or the current snapshot leaves them
+// out.
+func restoreCheckpoint(commit string) (written, removed int, untouched []string, err error) {
+	current := takeGitSnapshot()
+	if current == nil {
+		return 0, 0, nil, fmt.Errorf("not a git repository")
+	}
+	tree := runGit("rev-parse", commit+"^{tree}")
+	if tree == "" {
+		return 0, 0, nil, fmt.Errorf("no such checkpoint commit %s", commit)
+	}
+	seen := map[string]bool{}
+	for _, path := range append(checkpointLeftOut(commit), current.Skipped...) {
+		if !seen[path] {
+			seen[path] = true
+			untouched = append(untouched, path)
+		}
+	}
+	sort.Strings(untouched)
+
+	// Diffing from the current state to the checkpoint: added, modified
+	// and retyped files are written, deleted ones removed.
+	write := runGit("diff", "--name-only", "-z", "--no-renames", "--diff-filter=AMT", current.Tree, tree)
+	remove := strings.Split(runGit("diff", "--name-only", "-z", "--no-renames", "--diff-filter=D", current.Tree, tree), "\x00")
+
+	tmp, err := os.MkdirTemp("", "icc-index-")
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer os.RemoveAll(tmp)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+	if _, err := gitEnv(env, "read-tree", tree); err != nil {
+		return 0, 0, nil, err
+	}
+	if write != "" {
+		if _, err := gitEnvInput(env, write, "checkout-index", "-f", "-z", "--stdin"); err != nil {
+			return 0, 0, nil, err
+		}
+		written = strings.Count(write, "\x00")
+	}
+
+	top := runGit("rev-parse", "--show-toplevel")
+	for _, path := range remove {
+		if path == "" {
+			continue
+		}
+		full := filepath.Join(top, path)
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return written, removed, nil, err
+		}
+		removed++
+		// Drop directories the removal left empty.
+		for dir := filepath.Dir(full); dir != top && os.Remove(dir) == nil; dir = filepath.Dir(dir) {
+		}
+	}
+	return written, removed, untouched, nil
+}
+
+// runCheckpoints implements 'icc checkpoints <run>'.
+func runCheckpoints(args []string) {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Usage: icc checkpoints <run>")
+		os.Exit(1)
+	}
+	run := loadRunInWorkdir(args[0])
+	cps := listCheckpoints(run.ID)
+	if len(cps) == 0 {
+		logMsg("Run %s has no checkpoints (start it with --checkpoint)", run.ID)
+		return
+	}
+	for _, cp := range cps {
+		fmt.Printf("%-8s %s  %s  %s\n", cp.Name, shortHash(cp.Commit), cp.Date, cp.Subject)
+	}
+	fmt.Printf("\nRestore with: icc restore %s <session>\n", run.ID)
+}
+
+// runRestore implements 'icc restore <run> <session>'. The current state
+// is saved as a checkpoint first, so a restore can itself be undone.
+func runRestore(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: icc restore <run> <session>")
+		os.Exit(1)
+	}
+	run := loadRunInWorkdir(args[0])
+	name := args[1]
+	if _, err := strconv.Atoi(name); err == nil {
+		name = "s" + name
+	}
+	commit := runGit("rev-parse", "--verify", "--quiet", checkpointRefPrefix(run.ID)+name)
+	if commit == "" {
+		errMsg("Run %s has no checkpoint %s (see 'icc checkpoints %s')", run.ID, name, run.ID)
+		os.Exit(1)
+	}
+	if run.Mode == "tty" && tmuxCmd("has-session", "-t", run.ID) == nil {
+		errMsg("Run %s is still running in tmux; stop it before restoring", run.ID)
+		os.Exit(1)
+	}
+
+	saved := checkpointRefPrefix(run.ID) + "pre-restore-" + time.Now().Format("20060102-150405")
+	if _, err := createCheckpoint(saved, "", fmt.Sprintf("icc %s: state before restoring %s", run.ID, name)); err != nil {
+		errMsg("Failed to save the current state: %v", err)
+		os.Exit(1)
+	}
+	written, removed, untouched, err := restoreCheckpoint(commit)
+	if err != nil {
+		errMsg("Restore failed: %v (the previous state is saved as %s)", err, saved)
+		os.Exit(1)
+	}
+	okMsg("Restored %s of run %s: %d files written, %d removed", name, run.ID, written, removed)
+	top := runGit("rev-parse", "--show-toplevel")
+	for _, path := range untouched {
+		state := "left as it is"
+		if !fileExists(filepath.Join(top, path)) {
+			state = "missing, not in any checkpoint"
+		}
+		errMsg("Not restored (untracked, over %d MiB): %s, %s", maxUntrackedSnapshotSize>>20, path, state)
+	}
+	logMsg("The previous state is saved as %s", saved)
+	logMsg("HEAD and the index are unchanged; review with 'git status'")
+}
+
+// loadRunInWorkdir loads a run and changes to its working directory, where
+// its checkpoints live.
+func loadRunInWorkdir(id string) *runManifest {
+	run, err := loadRun(id)
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
+	}
+	if run.Workdir != "" {
+		if err := os.Chdir(run.Workdir); err != nil {
+			errMsg("Cannot enter the run's working directory: %v", err)
+			os.Exit(1)
+		}
+	}
+	return run
+}
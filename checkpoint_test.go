@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointMessage(t *testing.T) {
+	rec := sessionRecord{Number: 2, Outcome: "handoff", Reason: "handoff written",
+		Handoff: parseHandoff("## Q0: State\n- A REST API; auth done, tests next.\nMore detail.")}
+	got := checkpointMessage("icc-abc", rec)
+	if !strings.HasPrefix(got, "icc icc-abc s2: A REST API; auth done, tests next.\n\n- A REST API") {
+		t.Errorf("message = %q", got)
+	}
+
+	rec = sessionRecord{Number: 3, Outcome: "crashed", Reason: "exited with status 1"}
+	if got := checkpointMessage("icc-abc", rec); got != "icc icc-abc s3: crashed (exited with status 1)" {
+		t.Errorf("message without handoff = %q", got)
+	}
+}
+
+func TestCheckpointAndRestore(t *testing.T) {
+	dir := initTestRepo(t)
+	writeTestFile(filepath.Join(dir, "keep.txt"), "v1\n")
+	gitTest(t, "add", "keep.txt")
+	gitTest(t, "commit", "-q", "-m", "initial")
+	head := gitTest(t, "rev-parse", "HEAD")
+
+	// Session 1: modify a tracked file and add an untracked one.
+	writeTestFile(filepath.Join(dir, "keep.txt"), "v2\n")
+	os.Mkdir(filepath.Join(dir, "src"), 0755)
+	writeTestFile(filepath.Join(dir, "src", "new.txt"), "new\n")
+	run := &runManifest{ID: "icc-test"}
+	rec := sessionRecord{Number: 1, Outcome: "handoff"}
+	rec.Checkpoint = checkpointSession(run, rec)
+	if rec.Checkpoint == "" {
+		t.Fatal("no checkpoint created")
+	}
+	run.Sessions = append(run.Sessions, rec)
+
+	if got := gitTest(t, "rev-parse", "HEAD"); got != head {
+		t.Error("checkpoint moved HEAD")
+	}
+	if got := gitTest(t, "diff", "--cached", "--name-only"); got != "" {
+		t.Errorf("checkpoint changed the index: %q", got)
+	}
+	if parent := strings.TrimSpace(gitTest(t, "rev-parse", rec.Checkpoint+"^")); parent != strings.TrimSpace(head) {
+		t.Errorf("first checkpoint parent = %s, want HEAD", parent)
+	}
+
+	// Session 2 wrecks the tree.
+	os.Remove(filepath.Join(dir, "keep.txt"))
+	os.Remove(filepath.Join(dir, "src", "new.txt"))
+	os.MkdirAll(filepath.Join(dir, "junk", "deep"), 0755)
+	writeTestFile(filepath.Join(dir, "junk", "deep", "junk.txt"), "junk\n")
+	rec2 := sessionRecord{Number: 2, Outcome: "handoff"}
+	rec2.Checkpoint = checkpointSession(run, rec2)
+	if parent := strings.TrimSpace(gitTest(t, "rev-parse", rec2.Checkpoint+"^")); parent != rec.Checkpoint {
+		t.Errorf("second checkpoint parent = %s, want the first checkpoint", parent)
+	}
+	checkpointSession(run, sessionRecord{Number: 10, Outcome: "handoff"})
+
+	var names []string
+	for _, cp := range listCheckpoints("icc-test") {
+		names = append(names, cp.Name)
+	}
+	if strings.Join(names, ",") != "s1,s2,s10" {
+		t.Errorf("checkpoints = %v", names)
+	}
+
+	written, removed, untouched, err := restoreCheckpoint(rec.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 2 || removed != 1 || len(untouched) != 0 {
+		t.Errorf("restore wrote %d and removed %d files, want 2 and 1", written, removed)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "keep.txt")); string(data) != "v2\n" {
+		t.Errorf("keep.txt = %q", data)
+	}
+	if !fileExists(filepath.Join(dir, "src", "new.txt")) {
+		t.Error("untracked file from the checkpoint not restored")
+	}
+	if fileExists(filepath.Join(dir, "junk")) {
+		t.Error("files added after the checkpoint should be removed, with their empty directories")
+	}
+	if got := gitTest(t, "diff", "--cached", "--name-only"); got != "" {
+		t.Errorf("restore changed the index: %q", got)
+	}
+}
+
+func TestCheckpointListsLargeUntrackedFiles(t *testing.T) {
+	dir := initTestRepo(t)
+	writeTestFile(filepath.Join(dir, "small.txt"), "x\n")
+	big := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(big, make([]byte, maxUntrackedSnapshotSize+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := &runManifest{ID: "icc-test"}
+	commit := checkpointSession(run, sessionRecord{Number: 1, Outcome: "handoff"})
+	if commit == "" {
+		t.Fatal("checkpoint failed")
+	}
+	if got := checkpointLeftOut(commit); len(got) != 1 || got[0] != "data.bin" {
+		t.Errorf("checkpointLeftOut = %v, want [data.bin]", got)
+	}
+
+	os.Remove(big)
+	_, _, untouched, err := restoreCheckpoint(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(untouched) != 1 || untouched[0] != "data.bin" {
+		t.Errorf("untouched = %v, want [data.bin]", untouched)
+	}
+	if fileExists(big) {
+		t.Error("restore recreated a file the checkpoint does not hold")
+	}
+}
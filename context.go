@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// usageScanner computes context usage from a transcript JSONL, for the
+// context meter and 'icc hook': the usage of the latest assistant entry
+// with more than 20 output tokens, summing input, cache creation, cache
+// read and output tokens. It reads incrementally, only the lines appended
+// since the previous scan.
+type usageScanner struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"` // bytes consumed, always at a line boundary
+	Usage  int    `json:"usage"`
+}
+
+// scan consumes complete lines appended since the last call. A transcript
+// that shrank (rewritten) is rescanned from the start.
+func (s *usageScanner) scan() error {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < s.Offset {
+		s.Offset, s.Usage = 0, 0
+	}
+	if info.Size() == s.Offset {
+		return nil
+	}
+	if _, err := f.Seek(s.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	// Leave a partially written last line for the next scan.
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil
+	}
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		if tokens, ok := entryContextTokens(line); ok {
+			s.Usage = tokens
+		}
+	}
+	s.Offset += int64(end + 1)
+	return nil
+}
+
+// entryContextTokens returns the context size recorded by one transcript
+// line, if it is an assistant entry that counts.
+func entryContextTokens(line []byte) (int, bool) {
+	// Cheap pre-filter: most lines are not assistant entries with usage.
+	if !bytes.Contains(line, []byte(`"usage"`)) {
+		return 0, false
+	}
+	var e struct {
+		Type    string `json:"type"`
+		Message struct {
+			Usage struct {
+				InputTokens              int `json:"input_tokens"`
+				CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+				CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+				OutputTokens             int `json:"output_tokens"`
+			} `json:"usage"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(line, &e); err != nil || e.Type != "assistant" {
+		return 0, false
+	}
+	u := e.Message.Usage
+	if u.OutputTokens <= 20 {
+		return 0, false
+	}
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens + u.OutputTokens, true
+}
+
+// contextMeterBar renders usage against the critical threshold,
+// e.g. "123k / 190k (64%) [████████████░░░░░░░░]".
+func contextMeterBar(used, critical int) string {
+	const width = 20
+	pct := 0
+	if critical > 0 {
+		pct = used * 100 / critical
+	}
+	filled := pct * width / 100
+	if filled > width {
+		filled = width
+	}
+	return fmt.Sprintf("%dk / %dk (%d%%) [%s%s]", used/1000, critical/1000, pct,
+		strings.Repeat("█", filled), strings.Repeat("░", width-filled))
+}
+
+// contextMonitor follows a TTY session's transcript, as recorded by the
+// hook, and prints a context meter. Warning the agent is left to the hook,
+// except in runs without one (--no-hooks), where the monitor guesses the
+// transcript and warns the agent through the pane itself.
+type contextMonitor struct {
+	RunDir      string
+	Workdir     string
+	Pane        string
+	HandoffPath string
+	Since       time.Time // the session start; older transcripts are ignored
+	Warn        int
+	Critical    int
+	Inject      bool // no hook: guess the transcript and send warnings into the pane
+}
+
+// meterStep is the usage change that prints a new meter line.
+const meterStep = 10000
+
+// start runs the monitor until the returned stop function is called.
+func (c contextMonitor) start() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(3 * time.Second)
+		defer ticker.Stop()
+		var s usageScanner
+		shown, warned, critical := 0, false, false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if s.Path == "" {
+				if s.Path = sessionTranscript(c.RunDir, c.Workdir, c.Since, c.Inject); s.Path == "" {
+					continue
+				}
+			}
+			if err := s.scan(); err != nil || s.Usage == 0 {
+				continue
+			}
+			if s.Usage/meterStep != shown/meterStep {
+				shown = s.Usage
+				logMsg("Context: %s", contextMeterBar(s.Usage, c.Critical))
+			}
+			if !c.Inject {
+				continue
+			}
+			if s.Usage >= c.Critical && !critical {
+				critical, warned = true, true
+				logMsg("Context over the critical threshold, instructing the agent to hand off")
+				sendPrompt(c.Pane, contextCriticalMessage(s.Usage, c.Critical, c.HandoffPath))
+			} else if s.Usage >= c.Warn && !warned {
+				warned = true
+				logMsg("Context over the warning threshold, reminding the agent to hand off")
+				sendPrompt(c.Pane, contextWarnMessage(s.Usage, c.Critical, c.HandoffPath))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// contextWarnMessage mirrors the hook's PostToolUse reminder.
+func contextWarnMessage(used, critical int, handoffPath string) string {
+	return fmt.Sprintf(`[ICC SUPERVISOR] ⚠ Context used %d tokens, approximately %d tokens remaining before the hard limit. Finish your current step as soon as possible, then write the handoff file to %s (follow the format in the system instructions).`,
+		used, critical-used, handoffPath)
+}
+
+// contextCriticalMessage mirrors the hook's PreToolUse denial.
+func contextCriticalMessage(used, critical int, handoffPath string) string {
+	return fmt.Sprintf(`[ICC SUPERVISOR] ⚠ Context used %d tokens, over the limit of %d. Stop exploring now and write the handoff file to %s immediately (follow the format in the system instructions).`,
+		used, critical, handoffPath)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func assistantLine(input, cacheCreate, cacheRead, output int) string {
+	return fmt.Sprintf(`{"type":"assistant","message":{"role":"assistant","usage":{"input_tokens":%d,"cache_creation_input_tokens":%d,"cache_read_input_tokens":%d,"output_tokens":%d}}}`,
+		input, cacheCreate, cacheRead, output)
+}
+
+func appendTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(content)
+}
+
+func TestEntryContextTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want int
+		ok   bool
+	}{
+		{"sums all usage fields", assistantLine(10, 200, 3000, 40), 3250, true},
+		{"ignores short outputs", assistantLine(10, 200, 3000, 20), 0, false},
+		{"ignores user entries", `{"type":"user","message":{"usage":{"output_tokens":100}}}`, 0, false},
+		{"ignores entries without usage", `{"type":"assistant","message":{"content":"hi"}}`, 0, false},
+		{"ignores invalid json", `{"usage": `, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := entryContextTokens([]byte(tt.line))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got (%d, %v), want (%d, %v)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestUsageScanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	s := usageScanner{Path: path}
+
+	if err := s.scan(); err == nil {
+		t.Error("expected error for missing transcript")
+	}
+
+	appendTestFile(t, path, assistantLine(1000, 0, 0, 100)+"\n"+`{"type":"user"}`+"\n")
+	if err := s.scan(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Usage != 1100 {
+		t.Errorf("usage = %d, want 1100", s.Usage)
+	}
+
+	t.Run("later entries win and short outputs are skipped", func(t *testing.T) {
+		appendTestFile(t, path, assistantLine(2000, 0, 0, 100)+"\n"+assistantLine(9000, 0, 0, 5)+"\n")
+		s.scan()
+		if s.Usage != 2100 {
+			t.Errorf("usage = %d, want 2100", s.Usage)
+		}
+	})
+
+	t.Run("partial line is left for the next scan", func(t *testing.T) {
+		line := assistantLine(3000, 0, 0, 100)
+		appendTestFile(t, path, line[:20])
+		s.scan()
+		if s.Usage != 2100 {
+			t.Errorf("partial line was consumed, usage = %d", s.Usage)
+		}
+		appendTestFile(t, path, line[20:]+"\n")
+		s.scan()
+		if s.Usage != 3100 {
+			t.Errorf("usage = %d, want 3100", s.Usage)
+		}
+	})
+
+	t.Run("rewritten transcript is rescanned", func(t *testing.T) {
+		writeTestFile(path, assistantLine(500, 0, 0, 50)+"\n")
+		s.scan()
+		if s.Usage != 550 {
+			t.Errorf("usage = %d, want 550", s.Usage)
+		}
+	})
+}
+
+func TestContextMeterBar(t *testing.T) {
+	got := contextMeterBar(95000, 190000)
+	if !strings.HasPrefix(got, "95k / 190k (50%) [") {
+		t.Errorf("unexpected meter %q", got)
+	}
+	if strings.Count(got, "█") != 10 || strings.Count(got, "░") != 10 {
+		t.Errorf("expected half-filled bar, got %q", got)
+	}
+	if over := contextMeterBar(250000, 190000); strings.Contains(over, "░") {
+		t.Errorf("bar should be full past critical, got %q", over)
+	}
+}
+
+func TestContextMessages(t *testing.T) {
+	warn := contextWarnMessage(176000, 190000, "/tmp/icc-handoff-x.md")
+	if !strings.Contains(warn, "14000 tokens remaining") || !strings.Contains(warn, "/tmp/icc-handoff-x.md") {
+		t.Errorf("unexpected warning %q", warn)
+	}
+	crit := contextCriticalMessage(191000, 190000, "/tmp/icc-handoff-x.md")
+	if !strings.Contains(crit, "immediately") {
+		t.Errorf("unexpected critical message %q", crit)
+	}
+}
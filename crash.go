@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxConsecutiveCrashes stops a run whose recovery sessions keep crashing,
+// e.g. because of an auth error that a fresh session cannot fix.
+const maxConsecutiveCrashes = 3
+
+// exitStatusPath is where the pane's shell records the exit status of the
+// claude invocation for a session.
+func exitStatusPath(runDir string, session int) string {
+	return filepath.Join(runDir, fmt.Sprintf("s%d.exit", session))
+}
+
+// readExitStatus waits up to timeout for the shell to write the exit status
+// file and returns the status. ok is false if it never appeared.
+func readExitStatus(path string, timeout time.Duration) (code int, ok bool) {
+	pollUntil(func() bool { return fileExists(path) }, timeout, 100*time.Millisecond)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	code, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	return code, err == nil
+}
+
+// describeExit explains a non-zero exit status as reported by a POSIX
+// shell, where 128+N means "killed by signal N".
+func describeExit(code int) string {
+	if code > 128 && code < 128+65 {
+		sig := syscall.Signal(code - 128)
+		desc := fmt.Sprintf("killed by signal %d (%s)", code-128, sig)
+		if sig == syscall.SIGKILL {
+			desc += ", possibly out of memory"
+		}
+		return desc
+	}
+	return fmt.Sprintf("exited with status %d", code)
+}
+
+// crashRecoveryNote stands in for a handoff when a session crashed.
+// It carries the reason and the last transcript messages so the recovery
+// session can pick up where the crashed one stopped.
+func crashRecoveryNote(session int, reason, paneTail, transcript string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "(No handoff was written. Session %d crashed: %s.\n", session, reason)
+	b.WriteString("Reorient from the repository state above and the last messages below, verify what was finished, and continue the task.)\n")
+	if paneTail != "" {
+		b.WriteString("\n### Terminal output at the crash\n```\n" + paneTail + "\n```\n")
+	}
+	if transcript != "" {
+		b.WriteString("\n### Last messages of the crashed session\n" + transcript + "\n")
+	}
+	return b.String()
+}
+
+// tailBuffer is an io.Writer that keeps only the last max bytes written,
+// used to capture the end of claude's stderr in pipe mode.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return strings.TrimSpace(string(t.buf))
+}
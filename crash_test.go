@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribeExit(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{1, "exited with status 1"},
+		{137, "killed by signal 9 (killed), possibly out of memory"},
+		{139, "killed by signal 11 (segmentation fault)"},
+	}
+	for _, tt := range tests {
+		if got := describeExit(tt.code); got != tt.want {
+			t.Errorf("describeExit(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestReadExitStatus(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("reads status written by the shell", func(t *testing.T) {
+		path := exitStatusPath(dir, 1)
+		writeTestFile(path, "139\n")
+		code, ok := readExitStatus(path, time.Second)
+		if !ok || code != 139 {
+			t.Errorf("got (%d, %v), want (139, true)", code, ok)
+		}
+	})
+
+	t.Run("waits for a late file", func(t *testing.T) {
+		path := exitStatusPath(dir, 2)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			writeTestFile(path, "0\n")
+		}()
+		code, ok := readExitStatus(path, time.Second)
+		if !ok || code != 0 {
+			t.Errorf("got (%d, %v), want (0, true)", code, ok)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, ok := readExitStatus(filepath.Join(dir, "none.exit"), 50*time.Millisecond); ok {
+			t.Error("expected ok=false for missing file")
+		}
+	})
+}
+
+func TestCrashRecoveryNote(t *testing.T) {
+	got := crashRecoveryNote(3, "exited with status 1", "Error: invalid API key", "[assistant] Running the tests")
+	for _, want := range []string{"Session 3 crashed", "exited with status 1", "invalid API key", "Running the tests"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("note missing %q", want)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tb := &tailBuffer{max: 8}
+	tb.Write([]byte("hello "))
+	tb.Write([]byte("world!"))
+	if got := tb.String(); got != "o world!" {
+		t.Errorf("got %q, want %q", got, "o world!")
+	}
+}
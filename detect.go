@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
 	"strings"
@@ -10,18 +13,56 @@ import (
 // pollUntil calls checkFn repeatedly until it returns true or timeout is reached.
 // Returns true if the condition was met, false on timeout.
 func pollUntil(checkFn func() bool, timeout, interval time.Duration) bool {
+	ok, _ := pollUntilInterrupted(checkFn, timeout, interval, nil)
+	return ok
+}
+
+// pollUntilInterrupted is pollUntil that gives up as soon as interrupt
+// receives; interrupted reports that it did. A nil interrupt never does.
+func pollUntilInterrupted(checkFn func() bool, timeout, interval time.Duration, interrupt <-chan os.Signal) (ok, interrupted bool) {
 	deadline := time.Now().Add(timeout)
 	for {
 		if checkFn() {
-			return true
+			return true, false
 		}
 		if time.Now().After(deadline) {
-			return false
+			return false, false
+		}
+		if sleepInterrupted(interval, interrupt) {
+			return false, true
+		}
+	}
+}
+
+// sleepInterrupted sleeps for d, or until interrupt receives, and reports
+// whether it was interrupted.
+func sleepInterrupted(d time.Duration, interrupt <-chan os.Signal) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return false
+	case <-interrupt:
+		return true
+	}
+}
+
+// resetTimer makes t fire at at. A tick that fired before the reset is
+// dropped: with go 1.21 timers it would otherwise stay buffered in t.C and
+// be received right away.
+func resetTimer(t *time.Timer, at time.Time) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
 		}
-		time.Sleep(interval)
 	}
+	t.Reset(time.Until(at))
 }
 
+// errInterrupted is returned by waits the user cut short with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
 // capturePaneBottom captures the tmux pane and returns the last N non-empty lines.
 func capturePaneBottom(pane string, n int) string {
 	cmd := exec.Command("tmux", "capture-pane", "-t", pane, "-p")
@@ -29,16 +70,17 @@ func capturePaneBottom(pane string, n int) string {
 	if err != nil {
 		return ""
 	}
-	lines := strings.Split(string(out), "\n")
+	return lastLines(string(out), n)
+}
+
+// lastLines returns the last n non-empty lines of text.
+func lastLines(text string, n int) string {
 	var nonEmpty []string
-	for _, l := range lines {
+	for _, l := range strings.Split(text, "\n") {
 		if strings.TrimSpace(l) != "" {
 			nonEmpty = append(nonEmpty, l)
 		}
 	}
-	if len(nonEmpty) == 0 {
-		return ""
-	}
 	start := len(nonEmpty) - n
 	if start < 0 {
 		start = 0
@@ -74,12 +116,56 @@ func isShellForeground(pane string) bool {
 
 // waitForClaudeReady clears the pane history then waits for the claude ❯ prompt.
 // Clearing first prevents false positives from a previous session's ❯.
-func waitForClaudeReady(pane string, timeout time.Duration) bool {
+// Known startup screens (trust, login, notices) are handled along the way;
+// they are checked before ❯ because their selection menus use the same glyph.
+// Returns an error describing why claude did not become ready, or
+// errInterrupted if interrupt received first.
+func waitForClaudeReady(pane, workdir string, screens []startupScreen, timeout time.Duration, interrupt <-chan os.Signal) error {
 	exec.Command("tmux", "clear-history", "-t", pane).Run()
 
-	return pollUntil(func() bool {
-		return strings.Contains(capturePaneBottom(pane, 6), "❯")
-	}, timeout, 2*time.Second)
+	var failure error
+	handled := map[string]int{}
+	ok, interrupted := pollUntilInterrupted(func() bool {
+		text := capturePaneBottom(pane, 25)
+		if s := matchStartupScreen(screens, text); s != nil {
+			failure = handleStartupScreen(pane, workdir, s, text, handled)
+			return failure != nil
+		}
+		return paneShowsReadyPrompt(text)
+	}, timeout, 2*time.Second, interrupt)
+
+	if interrupted {
+		return errInterrupted
+	}
+	if failure != nil {
+		return failure
+	}
+	if !ok {
+		return fmt.Errorf("claude did not show its input prompt within %s", timeout)
+	}
+	return nil
+}
+
+// handleStartupScreen performs a screen's action. It returns an error when
+// the run must be aborted. A screen that keeps reappearing after three
+// attempts is treated as stuck.
+func handleStartupScreen(pane, workdir string, s *startupScreen, text string, handled map[string]int) error {
+	if s.Action == actionFail {
+		return fmt.Errorf("startup screen %q: %s", s.Name, s.Message)
+	}
+	if handled[s.Name] >= 3 {
+		return fmt.Errorf("startup screen %q did not go away after %d attempts", s.Name, handled[s.Name])
+	}
+	if s.Action == actionTrust && !paneShowsDir(text, workdir) {
+		return fmt.Errorf("startup screen %q asks to trust a folder other than %s", s.Name, workdir)
+	}
+	handled[s.Name]++
+	logMsg("Startup screen %q: %s", s.Name, s.Action)
+	for _, key := range s.Keys {
+		tmuxSendKeys(pane, key)
+		time.Sleep(300 * time.Millisecond)
+	}
+	return nil
 }
 
 // gracefulExit sends Esc + /exit to the claude session and waits for shell prompt.
@@ -87,58 +173,264 @@ func waitForClaudeReady(pane string, timeout time.Duration) bool {
 // We must send "/exit" as literal text (-l), wait for autocomplete to render,
 // then press Enter to select the first match. Sending "/exit" + Enter together
 // races with autocomplete and fails.
-func gracefulExit(pane string, timeout time.Duration) {
-	tmuxSendKeys(pane, "Escape")
-	time.Sleep(500 * time.Millisecond)
-	tmuxSendLiteral(pane, "/exit")
-	time.Sleep(2 * time.Second)
-	tmuxSendKeys(pane, "Enter")
-
-	ok := pollUntil(func() bool {
-		return isShellForeground(pane)
-	}, timeout, 1*time.Second)
-
-	if !ok {
-		// Fallback: Ctrl+C to interrupt, then retry /exit
-		tmuxSendKeys(pane, "C-c")
-		time.Sleep(1 * time.Second)
+// It gives up as soon as interrupt receives, and reports whether it did.
+func gracefulExit(pane string, timeout time.Duration, interrupt <-chan os.Signal) (interrupted bool) {
+	sendExit := func() bool {
 		tmuxSendKeys(pane, "Escape")
-		time.Sleep(500 * time.Millisecond)
+		if sleepInterrupted(500*time.Millisecond, interrupt) {
+			return true
+		}
 		tmuxSendLiteral(pane, "/exit")
-		time.Sleep(2 * time.Second)
+		if sleepInterrupted(2*time.Second, interrupt) {
+			return true
+		}
 		tmuxSendKeys(pane, "Enter")
-		pollUntil(func() bool {
-			return isShellPrompt(pane)
-		}, 15*time.Second, 1*time.Second)
+		return false
+	}
+	if sendExit() {
+		return true
+	}
+	ok, interrupted := pollUntilInterrupted(func() bool {
+		return isShellForeground(pane)
+	}, timeout, 1*time.Second, interrupt)
+	if ok || interrupted {
+		return interrupted
+	}
+
+	// Fallback: Ctrl+C to interrupt, then retry /exit
+	tmuxSendKeys(pane, "C-c")
+	if sleepInterrupted(1*time.Second, interrupt) || sendExit() {
+		return true
+	}
+	_, interrupted = pollUntilInterrupted(func() bool {
+		return isShellPrompt(pane)
+	}, 15*time.Second, 1*time.Second, interrupt)
+	return interrupted
+}
+
+// waitForStableFile waits until path's size and mtime have not changed for
+// quiet, so a handoff that is still being written (Write followed by Edit)
+// is not read half-finished. Returns false if it keeps changing until timeout.
+// stop, if not nil, is checked at every poll; returning true ends the wait
+// early, also with false.
+func waitForStableFile(path string, quiet, timeout time.Duration, stop func() bool) bool {
+	last := fileSignature(path)
+	lastChange := time.Now()
+	interval := quiet / 4
+	if interval > 500*time.Millisecond {
+		interval = 500 * time.Millisecond
 	}
+	stopped := false
+	stable := pollUntil(func() bool {
+		if stop != nil && stop() {
+			stopped = true
+			return true
+		}
+		if sig := fileSignature(path); sig != last {
+			last = sig
+			lastChange = time.Now()
+			return false
+		}
+		return time.Since(lastChange) >= quiet
+	}, timeout, interval)
+	return stable && !stopped
 }
 
-// waitForSignal waits for a handoff file to appear or claude to exit (shell prompt).
-// Returns: 0 = handoff file, 1 = shell prompt (claude exited), 2 = timeout.
-func waitForSignal(handoffPath, pane string, timeout time.Duration) int {
-	time.Sleep(5 * time.Second) // Let claude start processing
+// maxHandoffNudges bounds how often an incomplete handoff is sent back to
+// the agent before it is accepted as-is.
+const maxHandoffNudges = 2
 
-	deadline := time.Now().Add(timeout)
+// sessionWatch is what waitForSignal needs to supervise one claude session.
+type sessionWatch struct {
+	HandoffPath string
+	Pane        string
+	Session     int
+	Timeout     time.Duration // 0 = unlimited
+	Idle        idleConfig
+	Conditions  []paneCondition
+	Run         *runManifest // receives incidents; may be nil
+
+	ExitStatusPath string           // written by the pane's shell when claude exits
+	Interrupt      <-chan os.Signal // the user interrupting icc
+}
+
+// waitForSignal waits for a complete handoff file or for claude to exit.
+// Both are event driven: the handoff path is watched with watchFile and the
+// claude process with watchClaudeExit, so a signal is acted on immediately
+// and an idle supervisor does not poll tmux.
+// Once the handoff exists it must stop changing and contain the required
+// sections; if sections are missing the agent is asked to fix the file and
+// waitForSignal keeps waiting for the update.
+// The pane is also captured periodically: usage-limit and API-error
+// messages pause the session (the timeout is extended accordingly) and then
+// resume it with "continue", and an agent idling at its prompt is handled
+// according to the idle policy.
+// When claude exits, its recorded exit status tells a clean completion from
+// a crash.
+func waitForSignal(w sessionWatch) SessionOutcome {
+	done := make(chan struct{})
+	defer close(done)
+
+	// Start watching before the first check so a write in between is not lost.
+	fileChanged, stopWatch := watchFile(w.HandoffPath)
+	defer stopWatch()
+	claudeExited := watchClaudeExit(w.Pane, done)
+
+	var deadline <-chan time.Time
+	var deadlineAt time.Time
+	var deadlineTimer *time.Timer
+	if w.Timeout > 0 {
+		deadlineAt = time.Now().Add(w.Timeout)
+		deadlineTimer = time.NewTimer(w.Timeout)
+		defer deadlineTimer.Stop()
+		deadline = deadlineTimer.C
+	}
+
+	interval := 10 * time.Second
+	if w.Idle.Timeout > 0 {
+		interval = idleCheckInterval(w.Idle.Timeout)
+	}
+	paneTicker := time.NewTicker(interval)
+	defer paneTicker.Stop()
+	tracker := idleTracker{timeout: w.Idle.Timeout}
+	tracker.reset(time.Now())
+	idleActions := 0
+	var conditions conditionTracker
+
+	nudges := 0
+	checked := ""
+	var nudgeExpired <-chan time.Time
 	for {
-		// Check for handoff file first
-		if fileExists(handoffPath) {
-			time.Sleep(2 * time.Second)
-			if fileExists(handoffPath) {
-				return 0
+		if sig := fileSignature(w.HandoffPath); sig != "" && sig != checked {
+			// Writing the handoff can take a while; claude exiting, the
+			// deadline and the user are still watched meanwhile.
+			var stopped *SessionOutcome
+			waitForStableFile(w.HandoffPath, 3*time.Second, 60*time.Second, func() bool {
+				var o SessionOutcome
+				select {
+				case <-claudeExited:
+					o = exitOutcome(w)
+				case <-w.Interrupt:
+					o = SessionOutcome{Kind: OutcomeAborted, Reason: "interrupted"}
+				case <-deadline:
+					o = SessionOutcome{Kind: OutcomeTimedOut, Reason: fmt.Sprintf("no signal within %s", w.Timeout)}
+				default:
+					return false
+				}
+				stopped = &o
+				return true
+			})
+			if stopped != nil {
+				return *stopped
 			}
-		}
+			checked = fileSignature(w.HandoffPath)
 
-		// Check for shell foreground (claude has exited)
-		if isShellForeground(pane) {
-			time.Sleep(2 * time.Second)
-			if isShellForeground(pane) {
-				return 1
+			data, _ := os.ReadFile(w.HandoffPath)
+			missing := handoffMissingSections(string(data))
+			if len(missing) == 0 {
+				return SessionOutcome{Kind: OutcomeHandoff, Reason: "handoff written", Evidence: w.HandoffPath}
 			}
+			if nudges >= maxHandoffNudges {
+				errMsg("Handoff still incomplete (%s), accepting it as-is", strings.Join(missing, ", "))
+				return SessionOutcome{Kind: OutcomeHandoff, Reason: "incomplete handoff accepted", Evidence: strings.Join(missing, ", ")}
+			}
+			nudges++
+			logMsg("Handoff incomplete (%s), asking the agent to finish it", strings.Join(missing, ", "))
+			sendPrompt(w.Pane, incompleteHandoffMessage(w.HandoffPath, missing))
+			nudgeExpired = time.After(2 * time.Minute)
 		}
+		select {
+		case <-fileChanged:
+		case <-nudgeExpired:
+			errMsg("Agent did not update the incomplete handoff, accepting it as-is")
+			return SessionOutcome{Kind: OutcomeHandoff, Reason: "incomplete handoff accepted", Evidence: w.HandoffPath}
+		case <-claudeExited:
+			return exitOutcome(w)
+		case <-w.Interrupt:
+			return SessionOutcome{Kind: OutcomeAborted, Reason: "interrupted"}
+		case <-deadline:
+			return SessionOutcome{Kind: OutcomeTimedOut, Reason: fmt.Sprintf("no signal within %s", w.Timeout)}
+		case now := <-paneTicker.C:
+			text := capturePaneBottom(w.Pane, 50)
+			if idleActions > 0 && taskCompleteRe.MatchString(text) {
+				return SessionOutcome{Kind: OutcomeCompleted, Reason: "agent reported the task complete", Evidence: text}
+			}
+			stable := text == tracker.last
 
-		if timeout > 0 && time.Now().After(deadline) {
-			return 2
+			if len(w.Conditions) > 0 {
+				if m, attempt, ok := conditions.observe(w.Conditions, text, stable); ok {
+					wait := conditionWait(m, attempt, now)
+					resumeAt := now.Add(wait)
+					errMsg("Session %d: %s (%s) — pausing until %s", w.Session, m.Condition.Kind, m.Line, resumeAt.Format("15:04:05"))
+					w.Run.recordIncident(incident{
+						Time:    now,
+						Session: w.Session,
+						Kind:    m.Condition.Kind,
+						Detail:  m.Line,
+						Action:  fmt.Sprintf("paused %s, then sent continue", wait.Round(time.Second)),
+					})
+
+					pause := time.NewTimer(wait)
+					select {
+					case <-pause.C:
+					case <-claudeExited:
+						pause.Stop()
+						return exitOutcome(w)
+					case <-w.Interrupt:
+						pause.Stop()
+						return SessionOutcome{Kind: OutcomeAborted, Reason: "interrupted while paused"}
+					}
+					if deadlineTimer != nil {
+						deadlineAt = deadlineAt.Add(wait)
+						resetTimer(deadlineTimer, deadlineAt)
+					}
+					logMsg("Resuming session %d", w.Session)
+					sendPrompt(w.Pane, "continue")
+					tracker.reset(time.Now())
+					continue
+				}
+			}
+
+			if w.Idle.Timeout <= 0 || !tracker.observe(text, now) {
+				tracker.last = text
+				continue
+			}
+			tracker.reset(now)
+			idleActions++
+			switch {
+			case w.Idle.Policy == idlePolicyNudge && idleActions <= maxIdleNudges:
+				logMsg("Claude idle for %s, nudging (%d/%d)", w.Idle.Timeout, idleActions, maxIdleNudges)
+				sendPrompt(w.Pane, w.Idle.Nudge)
+			case w.Idle.Policy == idlePolicyReport && idleActions == 1:
+				logMsg("Claude idle for %s, asking for a completion report or handoff", w.Idle.Timeout)
+				sendPrompt(w.Pane, completionReportRequest(w.HandoffPath))
+			default:
+				return SessionOutcome{
+					Kind:     OutcomeIdle,
+					Reason:   fmt.Sprintf("unchanged at the prompt for %s", w.Idle.Timeout),
+					Evidence: text,
+				}
+			}
 		}
-		time.Sleep(2 * time.Second)
 	}
 }
+
+// exitOutcome classifies a session whose claude process has exited: a
+// handoff on disk wins, then the recorded exit status decides between a
+// clean completion and a crash. An unknown status counts as clean.
+func exitOutcome(w sessionWatch) SessionOutcome {
+	code, ok := readExitStatus(w.ExitStatusPath, 3*time.Second)
+	var o SessionOutcome
+	if ok {
+		o.ExitCode = &code
+	}
+	switch {
+	case fileExists(w.HandoffPath):
+		o.Kind, o.Reason, o.Evidence = OutcomeHandoff, "claude exited with handoff", w.HandoffPath
+	case ok && code != 0:
+		o.Kind, o.Reason, o.Evidence = OutcomeCrashed, describeExit(code), capturePaneBottom(w.Pane, 15)
+	default:
+		o.Kind, o.Reason = OutcomeCompleted, "claude exited cleanly without handoff"
+	}
+	return o
+}
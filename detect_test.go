@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -63,6 +65,43 @@ func TestShellPromptRe(t *testing.T) {
 	}
 }
 
+func TestPollUntilInterrupted(t *testing.T) {
+	interrupt := make(chan os.Signal, 1)
+	time.AfterFunc(50*time.Millisecond, func() { interrupt <- os.Interrupt })
+	start := time.Now()
+	ok, interrupted := pollUntilInterrupted(func() bool { return false }, time.Hour, 10*time.Second, interrupt)
+	if ok || !interrupted {
+		t.Errorf("got (%v, %v), want interrupted", ok, interrupted)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("returned after %s, want right after the interrupt", time.Since(start))
+	}
+	if sleepInterrupted(10*time.Millisecond, nil) {
+		t.Error("sleep with no interrupt channel was interrupted")
+	}
+}
+
+func TestResetTimerAfterFiring(t *testing.T) {
+	// A pause that outlasts the session deadline: the timer fires during
+	// the pause, then the deadline is extended by the pause.
+	deadline := time.NewTimer(10 * time.Millisecond)
+	defer deadline.Stop()
+	time.Sleep(50 * time.Millisecond)
+	resetTimer(deadline, time.Now().Add(time.Hour))
+	select {
+	case <-deadline.C:
+		t.Fatal("deadline that fired during the pause was received after the reset")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	resetTimer(deadline, time.Now().Add(10*time.Millisecond))
+	select {
+	case <-deadline.C:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset timer did not fire")
+	}
+}
+
 func TestPollUntil(t *testing.T) {
 	t.Run("returns true when condition met immediately", func(t *testing.T) {
 		got := pollUntil(func() bool { return true }, time.Second, 10*time.Millisecond)
@@ -91,3 +130,59 @@ func TestPollUntil(t *testing.T) {
 		}
 	})
 }
+
+func TestWaitForStableFile(t *testing.T) {
+	t.Run("returns true once the file stops changing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "handoff.md")
+		writeTestFile(path, "## Q0")
+		if !waitForStableFile(path, 50*time.Millisecond, time.Second, nil) {
+			t.Error("expected unchanged file to be stable")
+		}
+	})
+
+	t.Run("returns false while the file keeps changing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "handoff.md")
+		writeTestFile(path, "x")
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+		go func() {
+			defer close(stopped)
+			content := "x"
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(10 * time.Millisecond):
+					content += "x"
+					writeTestFile(path, content)
+				}
+			}
+		}()
+		if waitForStableFile(path, 200*time.Millisecond, 300*time.Millisecond, nil) {
+			t.Error("expected constantly changing file to be unstable")
+		}
+	})
+
+	t.Run("returns false as soon as stop does", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "handoff.md")
+		writeTestFile(path, "## Q0")
+		exited := make(chan struct{})
+		time.AfterFunc(50*time.Millisecond, func() { close(exited) })
+		start := time.Now()
+		stable := waitForStableFile(path, 10*time.Second, 20*time.Second, func() bool {
+			select {
+			case <-exited:
+				return true
+			default:
+				return false
+			}
+		})
+		if stable || time.Since(start) > 5*time.Second {
+			t.Errorf("got %v after %s, want false once stop returns true", stable, time.Since(start))
+		}
+	})
+}
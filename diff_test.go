@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(s ...string) string { return strings.Join(s, "\n") + "\n" }
+
+	t.Run("equal", func(t *testing.T) {
+		if got := unifiedDiff("a", "b", "x\n", "x\n"); got != "" {
+			t.Errorf("got %q, want empty", got)
+		}
+	})
+
+	t.Run("one change with context", func(t *testing.T) {
+		a := lines("1", "2", "3", "4", "5", "6", "7", "8")
+		b := lines("1", "2", "3", "4", "five", "6", "7", "8")
+		want := lines("--- a", "+++ b", "@@ -2,7 +2,7 @@", " 2", " 3", " 4", "-5", "+five", " 6", " 7", " 8")
+		if got := unifiedDiff("a", "b", a, b); got != want {
+			t.Errorf("got\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("separate hunks", func(t *testing.T) {
+		var a, b []string
+		for i := 0; i < 20; i++ {
+			a = append(a, string(rune('a'+i)))
+		}
+		b = append(b, a...)
+		b[1] = "B"
+		b = append(b[:15], b[16:]...) // delete "p"
+		got := unifiedDiff("a", "b", lines(a...), lines(b...))
+		if n := strings.Count(got, "@@ -"); n != 2 {
+			t.Fatalf("got %d hunks, want 2:\n%s", n, got)
+		}
+		for _, want := range []string{"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n", "@@ -13,7 +13,6 @@\n m\n n\n o\n-p\n q\n"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("missing hunk %q in\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("from empty", func(t *testing.T) {
+		want := lines("--- a", "+++ b", "@@ -0,0 +1,2 @@", "+x", "+y")
+		if got := unifiedDiff("a", "b", "", "x\ny\n"); got != want {
+			t.Errorf("got\n%s\nwant\n%s", got, want)
+		}
+	})
+}
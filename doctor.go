@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Doctor check results, worst last.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// minTmuxMajor and minTmuxMinor are the oldest tmux TTY mode works with:
+// the handoff key binding needs if-shell -F.
+const (
+	minTmuxMajor = 2
+	minTmuxMinor = 0
+)
+
+// doctorCheck is the result of one 'icc doctor' check. Fix says what to
+// do about a warn or fail.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// runDoctor implements 'icc doctor [--json]': it checks everything a run
+// depends on, using the same resolution as a real run, and exits 1 if any
+// check fails.
+func runDoctor(args []string) {
+	jsonOut := false
+	for _, a := range args {
+		switch a {
+		case "--json":
+			jsonOut = true
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\nUsage: icc doctor [--json]\n", a)
+			os.Exit(1)
+		}
+	}
+
+	checks := doctorChecks(defaultConfig())
+	ok := true
+	for _, c := range checks {
+		ok = ok && c.Status != checkFail
+	}
+
+	if jsonOut {
+		data, err := json.MarshalIndent(struct {
+			OK     bool          `json:"ok"`
+			Checks []doctorCheck `json:"checks"`
+		}{ok, checks}, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, c := range checks {
+			printDoctorCheck(c)
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func printDoctorCheck(c doctorCheck) {
+	mark := colorGreen + "✓"
+	switch c.Status {
+	case checkWarn:
+		mark = colorYellow + "!"
+	case checkFail:
+		mark = colorRed + "✗"
+	}
+	fmt.Printf("%s%s%s %s: %s\n", colorBold, mark, colorReset, c.Name, c.Detail)
+	if c.Fix != "" {
+		fmt.Printf("    fix: %s\n", c.Fix)
+	}
+}
+
+// doctorChecks runs every check against cfg, the configuration a run
+// would start with before flags.
+func doctorChecks(cfg Config) []doctorCheck {
+	checks := checkClaude()
+	checks = append(checks, checkTmux())
+
+	// Every scope's settings file is checked for syntax; the hook checks
+	// only look at the files that parse.
+	var hooks []scopeHooks
+	for _, scope := range installScopes {
+		path, err := scopeSettingsPath(scope)
+		if err != nil {
+			checks = append(checks, doctorCheck{Name: "settings (" + scope + ")", Status: checkFail, Detail: err.Error()})
+			continue
+		}
+		c := checkSettingsFile(scope, path)
+		checks = append(checks, c)
+		if c.Status == checkPass {
+			hooks = append(hooks, scopeHooks{scope, readHookStatus(path)})
+		}
+	}
+	checks = append(checks, checkHooks(hooks)...)
+	checks = append(checks, checkJq(hooks))
+
+	checks = append(checks, checkThresholds(cfg.WarnTokens, cfg.CriticalTokens))
+	if !validIdlePolicy(cfg.IdlePolicy) {
+		checks = append(checks, doctorCheck{Name: "idle policy", Status: checkFail,
+			Detail: fmt.Sprintf("IDLE_POLICY=%s is not nudge, report or exit", cfg.IdlePolicy),
+			Fix:    "Set IDLE_POLICY to nudge, report or exit"})
+	}
+	checks = append(checks, checkConfigFiles()...)
+	checks = append(checks, checkRunsDir(runsDir()))
+	return checks
+}
+
+// checkClaude resolves claude the way a run does and launches it with
+// --version, the way a run would launch it: outside any claude session.
+func checkClaude() []doctorCheck {
+	path, source, err := resolveClaude()
+	if err != nil {
+		return []doctorCheck{{Name: "claude", Status: checkFail, Detail: err.Error(),
+			Fix: "Install the claude CLI, or set CLAUDE_BIN to its path or to your wrapper"}}
+	}
+	checks := []doctorCheck{{Name: "claude", Status: checkPass, Detail: fmt.Sprintf("%s (from %s)", path, source)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "--version")
+	cmd.Env = withoutEnv(os.Environ(), "CLAUDECODE")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		detail := fmt.Sprintf("%s --version: %v", path, err)
+		if s := strings.TrimSpace(string(out)); s != "" {
+			detail += ": " + firstLine(s)
+		}
+		checks = append(checks, doctorCheck{Name: "claude --version", Status: checkFail, Detail: detail,
+			Fix: "Make sure " + path + " is the claude CLI, or a wrapper that passes its arguments through"})
+		return checks
+	}
+	return append(checks, doctorCheck{Name: "claude --version", Status: checkPass, Detail: firstLine(strings.TrimSpace(string(out)))})
+}
+
+// withoutEnv returns env without the variable key.
+func withoutEnv(env []string, key string) []string {
+	var out []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// checkTmux checks that tmux is installed and new enough. Without it only
+// pipe mode works, so a missing tmux is a warning.
+func checkTmux() doctorCheck {
+	fix := fmt.Sprintf("Install tmux %d.%d or newer, or use pipe mode (-p)", minTmuxMajor, minTmuxMinor)
+	path, err := exec.LookPath("tmux")
+	if err != nil {
+		return doctorCheck{Name: "tmux", Status: checkWarn, Detail: "not found in PATH; TTY mode needs it", Fix: fix}
+	}
+	out, err := exec.Command(path, "-V").Output()
+	if err != nil {
+		return doctorCheck{Name: "tmux", Status: checkWarn, Detail: fmt.Sprintf("%s -V: %v", path, err), Fix: fix}
+	}
+	v := strings.TrimSpace(string(out))
+	major, minor, ok := parseTmuxVersion(v)
+	switch {
+	case !ok:
+		return doctorCheck{Name: "tmux", Status: checkPass, Detail: v + " (unknown version format)"}
+	case major < minTmuxMajor || major == minTmuxMajor && minor < minTmuxMinor:
+		return doctorCheck{Name: "tmux", Status: checkWarn, Detail: v + " is too old for TTY mode", Fix: fix}
+	}
+	return doctorCheck{Name: "tmux", Status: checkPass, Detail: v}
+}
+
+var tmuxVersionRe = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// parseTmuxVersion parses the output of 'tmux -V', e.g. "tmux 3.3a" or
+// "tmux next-3.4". ok is false for builds without a version number, such
+// as "tmux master".
+func parseTmuxVersion(s string) (major, minor int, ok bool) {
+	m := tmuxVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+// checkSettingsFile checks that a scope's settings.json, if there is one,
+// is a JSON object.
+func checkSettingsFile(scope, path string) doctorCheck {
+	name := "settings (" + scope + ")"
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return doctorCheck{Name: name, Status: checkPass, Detail: path + " does not exist"}
+	}
+	if err != nil {
+		return doctorCheck{Name: name, Status: checkFail, Detail: err.Error(), Fix: "Make " + path + " readable"}
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return doctorCheck{Name: name, Status: checkFail, Detail: fmt.Sprintf("%s: %v", path, err),
+			Fix: "Fix the JSON in " + path + "; claude and icc install cannot read it as it is"}
+	}
+	return doctorCheck{Name: name, Status: checkPass, Detail: path + " parses"}
+}
+
+// scopeHooks is the context guard registered in one scope.
+type scopeHooks struct {
+	scope  string
+	status hookStatus
+}
+
+// checkHooks checks each registered context guard: both events, and a
+// command that runs this version of icc. No registered guard is fine: each
+// run passes one in its own settings file.
+func checkHooks(hooks []scopeHooks) []doctorCheck {
+	var checks []doctorCheck
+	for _, h := range hooks {
+		st := h.status
+		if len(st.Commands) == 0 {
+			continue
+		}
+		name := "hook (" + h.scope + ")"
+		fix := "icc install --scope " + h.scope
+		if len(st.Events) == 1 {
+			checks = append(checks, doctorCheck{Name: name, Status: checkWarn,
+				Detail: fmt.Sprintf("%s: registered for %s only", st.Path, st.Events[0]), Fix: fix})
+		}
+		for _, c := range st.Commands {
+			checks = append(checks, checkHookCommand(name, c, fix))
+		}
+	}
+	if len(checks) == 0 {
+		checks = append(checks, doctorCheck{Name: "hook", Status: checkPass,
+			Detail: "not installed; each run passes the context guard in its own settings file"})
+	}
+	return checks
+}
+
+// checkHookCommand checks one registered guard command.
+func checkHookCommand(name, cmd, fix string) doctorCheck {
+	if cmd == legacyHookCmd {
+		return doctorCheck{Name: name, Status: checkWarn,
+			Detail: legacyHookCmd + " is the old shell script, which needs jq and is no longer updated", Fix: fix}
+	}
+	v := hookCommandVersion(cmd)
+	switch {
+	case strings.HasSuffix(v, foreignHookBinary):
+		return doctorCheck{Name: name, Status: checkWarn,
+			Detail: fmt.Sprintf("%s: %s, as it is neither this icc nor the icc in PATH", cmd, foreignHookBinary), Fix: fix}
+	case !strings.HasPrefix(v, "icc "):
+		return doctorCheck{Name: name, Status: checkFail, Detail: fmt.Sprintf("%s: %s", cmd, v), Fix: fix}
+	case v != "icc "+version:
+		return doctorCheck{Name: name, Status: checkWarn,
+			Detail: fmt.Sprintf("%s runs %s, this is icc %s", cmd, v, version), Fix: fix}
+	}
+	return doctorCheck{Name: name, Status: checkPass, Detail: fmt.Sprintf("%s (%s)", cmd, v)}
+}
+
+// checkJq checks for jq, which only the legacy context-guard.sh needs.
+func checkJq(hooks []scopeHooks) doctorCheck {
+	legacy := false
+	for _, h := range hooks {
+		legacy = legacy || containsString(h.status.Commands, legacyHookCmd)
+	}
+	if !legacy {
+		return doctorCheck{Name: "jq", Status: checkPass, Detail: "not needed: the context guard is built into icc"}
+	}
+	if path, err := exec.LookPath("jq"); err == nil {
+		return doctorCheck{Name: "jq", Status: checkPass, Detail: path + " (used by the legacy context-guard.sh)"}
+	}
+	return doctorCheck{Name: "jq", Status: checkFail,
+		Detail: "not found in PATH; the registered context-guard.sh cannot read the context usage without it",
+		Fix:    "Run icc install to replace the script with icc hook, or install jq"}
+}
+
+// checkThresholds checks that the context warning comes before the deny.
+func checkThresholds(warn, critical int) doctorCheck {
+	const name = "token thresholds"
+	fix := "Set CTX_WARN_TOKENS (--warn-tokens) below CTX_CRITICAL_TOKENS (--critical-tokens)"
+	switch {
+	case warn <= 0 || critical <= 0:
+		return doctorCheck{Name: name, Status: checkFail,
+			Detail: fmt.Sprintf("warn %d and critical %d must be positive", warn, critical), Fix: fix}
+	case warn >= critical:
+		return doctorCheck{Name: name, Status: checkFail,
+			Detail: fmt.Sprintf("warn %d is not below critical %d: the agent is denied tools before it is warned", warn, critical), Fix: fix}
+	}
+	return doctorCheck{Name: name, Status: checkPass, Detail: fmt.Sprintf("warn %d < critical %d", warn, critical)}
+}
+
+// checkConfigFiles loads the prompt templates, startup screens and pane
+// conditions the way a run does.
+func checkConfigFiles() []doctorCheck {
+	var checks []doctorCheck
+	add := func(name, path string, err error) {
+		if err != nil {
+			checks = append(checks, doctorCheck{Name: name, Status: checkFail, Detail: err.Error(),
+				Fix: "Fix or remove " + path})
+			return
+		}
+		checks = append(checks, doctorCheck{Name: name, Status: checkPass, Detail: "loaded (" + path + " if present)"})
+	}
+	dir := promptTemplatesDir()
+	_, err := loadPromptTemplates(dir)
+	add("prompt templates", dir, err)
+	path := startupScreensPath()
+	_, err = loadStartupScreens(path)
+	add("startup screens", path, err)
+	path = paneConditionsPath()
+	_, err = loadPaneConditions(path)
+	add("pane conditions", path, err)
+	return checks
+}
+
+// checkRunsDir checks that run state can be written.
+func checkRunsDir(dir string) doctorCheck {
+	fix := "Make " + dir + " writable, or set ICC_RUNS_DIR"
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return doctorCheck{Name: "runs dir", Status: checkFail, Detail: err.Error(), Fix: fix}
+	}
+	if !privateDir(dir) {
+		return doctorCheck{Name: "runs dir", Status: checkFail,
+			Detail: filepath.Clean(dir) + " is owned by another user or writable by others", Fix: "Remove " + dir + ", or set ICC_RUNS_DIR"}
+	}
+	f, err := os.CreateTemp(dir, ".doctor-")
+	if err != nil {
+		return doctorCheck{Name: "runs dir", Status: checkFail, Detail: err.Error(), Fix: fix}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return doctorCheck{Name: "runs dir", Status: checkPass, Detail: filepath.Clean(dir) + " is writable"}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTmuxVersion(t *testing.T) {
+	tests := []struct {
+		in           string
+		major, minor int
+		ok           bool
+	}{
+		{"tmux 3.3a", 3, 3, true},
+		{"tmux 2.0", 2, 0, true},
+		{"tmux 1.8", 1, 8, true},
+		{"tmux next-3.4", 3, 4, true},
+		{"tmux openbsd-7.4", 7, 4, true},
+		{"tmux master", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseTmuxVersion(tt.in)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("parseTmuxVersion(%q) = %d, %d, %v; want %d, %d, %v", tt.in, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	tests := []struct {
+		warn, critical int
+		want           string
+	}{
+		{175000, 190000, checkPass},
+		{190000, 190000, checkFail},
+		{200000, 190000, checkFail},
+		{0, 190000, checkFail},
+	}
+	for _, tt := range tests {
+		c := checkThresholds(tt.warn, tt.critical)
+		if c.Status != tt.want {
+			t.Errorf("checkThresholds(%d, %d) = %s (%s), want %s", tt.warn, tt.critical, c.Status, c.Detail, tt.want)
+		}
+		if c.Status != checkPass && c.Fix == "" {
+			t.Errorf("checkThresholds(%d, %d): no fix", tt.warn, tt.critical)
+		}
+	}
+}
+
+func TestCheckSettingsFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	writeTestFile(valid, `{"hooks": {}}`)
+	writeTestFile(invalid, `{"hooks": {},}`)
+
+	if c := checkSettingsFile("user", filepath.Join(dir, "missing.json")); c.Status != checkPass {
+		t.Errorf("missing file: %s (%s), want pass", c.Status, c.Detail)
+	}
+	if c := checkSettingsFile("user", valid); c.Status != checkPass {
+		t.Errorf("valid file: %s (%s), want pass", c.Status, c.Detail)
+	}
+	c := checkSettingsFile("project", invalid)
+	if c.Status != checkFail || !strings.Contains(c.Fix, invalid) || c.Name != "settings (project)" {
+		t.Errorf("invalid file: %+v, want a fail naming the file", c)
+	}
+}
+
+func TestCheckHooks(t *testing.T) {
+	t.Run("none installed", func(t *testing.T) {
+		checks := checkHooks([]scopeHooks{{scopeUser, hookStatus{}}})
+		if len(checks) != 1 || checks[0].Status != checkPass {
+			t.Errorf("checks = %+v, want one pass", checks)
+		}
+	})
+
+	t.Run("legacy script", func(t *testing.T) {
+		st := hookStatus{Path: "/s.json", Events: []string{"PreToolUse", "PostToolUse"}, Commands: []string{legacyHookCmd}}
+		checks := checkHooks([]scopeHooks{{scopeProject, st}})
+		if len(checks) != 1 || checks[0].Status != checkWarn || checks[0].Fix != "icc install --scope project" {
+			t.Errorf("checks = %+v, want a warn to reinstall the project scope", checks)
+		}
+	})
+
+	t.Run("one event and a missing binary", func(t *testing.T) {
+		st := hookStatus{Path: "/s.json", Events: []string{"PreToolUse"}, Commands: []string{"/nonexistent/icc hook"}}
+		checks := checkHooks([]scopeHooks{{scopeUser, st}})
+		if len(checks) != 2 || checks[0].Status != checkWarn || checks[1].Status != checkFail {
+			t.Errorf("checks = %+v, want a warn and a fail", checks)
+		}
+	})
+}
+
+func TestCheckJq(t *testing.T) {
+	if c := checkJq([]scopeHooks{{scopeUser, hookStatus{Commands: []string{hookCommand()}}}}); c.Status != checkPass {
+		t.Errorf("icc hook: %+v, want pass without jq", c)
+	}
+	t.Setenv("PATH", t.TempDir())
+	c := checkJq([]scopeHooks{{scopeUser, hookStatus{Commands: []string{legacyHookCmd}}}})
+	if c.Status != checkFail || c.Fix == "" {
+		t.Errorf("legacy script without jq: %+v, want a fail with a fix", c)
+	}
+}
+
+func TestCheckRunsDir(t *testing.T) {
+	if c := checkRunsDir(filepath.Join(t.TempDir(), "runs")); c.Status != checkPass {
+		t.Errorf("checkRunsDir = %+v, want pass", c)
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	writeTestFile(file, "")
+	if c := checkRunsDir(filepath.Join(file, "runs")); c.Status != checkFail {
+		t.Errorf("checkRunsDir under a file = %+v, want fail", c)
+	}
+}
@@ -109,6 +109,9 @@ test_tty() {
         # Inject a fake handoff file to trigger the relay
         log "Injecting handoff file: $handoff_path"
         cat > "$handoff_path" << 'HANDOFF'
+---
+{"status": "in-progress", "next_steps": ["print relay verified"], "tests": "not-run"}
+---
 ## Q0: What is the current state of this project?
 E2E test: injected handoff to verify ICC relay mechanism.
 
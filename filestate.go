@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Caps on file snapshots: the files recorded, the size of a file that is
+// hashed (larger ones are compared by size and modification time only),
+// and the time after which a slow snapshot is logged.
+const (
+	maxSnapshotFiles  = 20000
+	maxHashedFileSize = 10 << 20
+	slowFileSnapshot  = 5 * time.Second
+)
+
+// skippedDirs are not walked by file snapshots: dependencies, caches and
+// icc's own configuration.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".icc":         true,
+	"node_modules": true,
+	"__pycache__":  true,
+	".venv":        true,
+	"venv":         true,
+	".cache":       true,
+}
+
+// fileSnapshot is the content of a directory that is not a git repository,
+// by relative path. It stands in for gitSnapshot there.
+type fileSnapshot struct {
+	Files   map[string]fileState
+	Partial bool // stopped at maxSnapshotFiles
+	At      time.Time
+}
+
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string // sha256 of the content; "" above maxHashedFileSize
+}
+
+// changed reports whether a file differs from old: by hash when both have
+// one, otherwise by size and modification time.
+func (st fileState) changed(old fileState) bool {
+	if st.Hash == "" || old.Hash == "" {
+		return st.Size != old.Size || !st.ModTime.Equal(old.ModTime)
+	}
+	return st.Hash != old.Hash
+}
+
+// takeFileSnapshot hashes the regular files under root. Files whose size
+// and modification time match prev keep their hash from prev instead of
+// being read again, and files over maxHashedFileSize are not read at all.
+// Unreadable files are left out. A partial or slow snapshot is logged.
+func takeFileSnapshot(root string, prev *fileSnapshot) *fileSnapshot {
+	start := time.Now()
+	s := &fileSnapshot{Files: map[string]fileState{}, At: start}
+	defer func() {
+		if s.Partial {
+			logMsg("File snapshot of %s stopped at %d files; later files are not compared", root, maxSnapshotFiles)
+		}
+		if took := time.Since(start); took > slowFileSnapshot {
+			logMsg("File snapshot of %s took %s (%d files)", root, took.Round(time.Second), len(s.Files))
+		}
+	}()
+	filepath.WalkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if e.IsDir() {
+			if path != root && skippedDirs[e.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !e.Type().IsRegular() {
+			return nil
+		}
+		if len(s.Files) >= maxSnapshotFiles {
+			s.Partial = true
+			return filepath.SkipAll
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		st := fileState{Size: info.Size(), ModTime: info.ModTime()}
+		if old, ok := prev.file(rel); ok && old.Size == st.Size && old.ModTime.Equal(st.ModTime) {
+			st.Hash = old.Hash
+		} else if st.Size > maxHashedFileSize {
+			// Compared by size and modification time only.
+		} else if st.Hash, err = hashFile(path); err != nil {
+			return nil
+		}
+		s.Files[rel] = st
+		return nil
+	})
+	return s
+}
+
+func (s *fileSnapshot) file(path string) (fileState, bool) {
+	if s == nil {
+		return fileState{}, false
+	}
+	st, ok := s.Files[path]
+	return st, ok
+}
+
+// lastWalked is the snapshot's last file in walk order: where the walk
+// stopped in a partial snapshot.
+func (s *fileSnapshot) lastWalked() string {
+	last := ""
+	for path := range s.Files {
+		if last == "" || walkBefore(last, path) {
+			last = path
+		}
+	}
+	return last
+}
+
+// walkBefore reports whether filepath.WalkDir visits slash-separated path
+// a before b: directory by directory, in lexical order of the names.
+func walkBefore(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileChanges lists the files added (A), modified (M) and deleted (D)
+// between two snapshots, one "X path" line each, sorted by path.
+func fileChanges(from, to *fileSnapshot) string {
+	if from == nil || to == nil {
+		return ""
+	}
+	// A partial snapshot holds the files up to where the walk stopped;
+	// past the earlier of the two stops, a file missing from one of them
+	// says nothing, so only the part both walked is compared.
+	cut := ""
+	for _, s := range []*fileSnapshot{from, to} {
+		if last := s.lastWalked(); s.Partial && (cut == "" || walkBefore(last, cut)) {
+			cut = last
+		}
+	}
+	compared := func(path string) bool { return cut == "" || !walkBefore(cut, path) }
+
+	var lines []string
+	for path, st := range to.Files {
+		if !compared(path) {
+			continue
+		}
+		if old, ok := from.Files[path]; !ok {
+			lines = append(lines, "A "+path)
+		} else if st.changed(old) {
+			lines = append(lines, "M "+path)
+		}
+	}
+	for path := range from.Files {
+		if _, ok := to.Files[path]; !ok && compared(path) {
+			lines = append(lines, "D "+path)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	out := capLines(strings.Join(lines, "\n"), maxDiffStatFiles)
+	if from.Partial || to.Partial {
+		out = strings.TrimLeft(out+fmt.Sprintf("\n(only the first %d files were compared)", maxSnapshotFiles), "\n")
+	}
+	return out
+}
+
+// setFileState fills the change lists of the continuation prompt outside a
+// git repository: run is the snapshot at run start, prev at the previous
+// session's start and cur now.
+func (d *promptData) setFileState(run, prev, cur *fileSnapshot) {
+	if cur == nil {
+		return
+	}
+	d.FileState = true
+	d.RunDiff = fileChanges(run, cur)
+	d.SessionDiff = fileChanges(prev, cur)
+}
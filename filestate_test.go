@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileChanges(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src", "node_modules/pkg"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := writeTestFile(filepath.Join(root, name), content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("keep.txt", "same")
+	write("src/main.go", "package main")
+	write("old.txt", "bye")
+	write("node_modules/pkg/index.js", "skipped")
+
+	base := takeFileSnapshot(root, nil)
+	if _, ok := base.Files["node_modules/pkg/index.js"]; ok {
+		t.Error("node_modules was walked")
+	}
+	if len(base.Files) != 3 {
+		t.Fatalf("base has %d files, want 3: %v", len(base.Files), base.Files)
+	}
+
+	write("src/main.go", "package main\n\nfunc main() {}")
+	write("src/new.go", "package main")
+	write("node_modules/pkg/index.js", "changed but skipped")
+	if err := os.Remove(filepath.Join(root, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	// Same size, later mtime: hashed again and found unchanged.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "keep.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	cur := takeFileSnapshot(root, base)
+	want := "D old.txt\nM src/main.go\nA src/new.go"
+	if got := fileChanges(base, cur); got != want {
+		t.Errorf("fileChanges =\n%s\nwant\n%s", got, want)
+	}
+	if got := fileChanges(cur, cur); got != "" {
+		t.Errorf("no changes: fileChanges = %q, want empty", got)
+	}
+	if got := fileChanges(nil, cur); got != "" {
+		t.Errorf("no base: fileChanges = %q, want empty", got)
+	}
+}
+
+func TestTakeFileSnapshotReusesHashes(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.txt")
+	if err := writeTestFile(path, "content"); err != nil {
+		t.Fatal(err)
+	}
+	prev := takeFileSnapshot(root, nil)
+	st := prev.Files["a.txt"]
+	st.Hash = "from-prev"
+	prev.Files["a.txt"] = st
+
+	if got := takeFileSnapshot(root, prev).Files["a.txt"].Hash; got != "from-prev" {
+		t.Errorf("unchanged file was hashed again: %q", got)
+	}
+}
+
+func TestTakeFileSnapshotLargeFiles(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "big.bin")
+	if err := os.WriteFile(path, make([]byte, maxHashedFileSize+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := takeFileSnapshot(root, nil)
+	if st := base.Files["big.bin"]; st.Hash != "" || st.Size != maxHashedFileSize+1 {
+		t.Fatalf("large file = %+v, want size only", st)
+	}
+	if got := fileChanges(base, takeFileSnapshot(root, nil)); got != "" {
+		t.Errorf("unchanged large file: %q", got)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if got := fileChanges(base, takeFileSnapshot(root, nil)); got != "M big.bin" {
+		t.Errorf("touched large file: %q, want M big.bin", got)
+	}
+}
+
+func TestFileChangesPartial(t *testing.T) {
+	snap := func(partial bool, paths ...string) *fileSnapshot {
+		s := &fileSnapshot{Files: map[string]fileState{}, Partial: partial}
+		for _, p := range paths {
+			s.Files[p] = fileState{Hash: "h"}
+		}
+		return s
+	}
+	// A new file early in the walk pushes the last ones past the cap: they
+	// are neither deleted nor added.
+	from := snap(true, "a.txt", "c/x", "c.txt", "d.txt")
+	to := snap(true, "a.txt", "b.txt", "c/x", "c.txt")
+	if got := fileChanges(from, to); got != fmt.Sprintf("A b.txt\n(only the first %d files were compared)", maxSnapshotFiles) {
+		t.Errorf("fileChanges = %q", got)
+	}
+
+	if !walkBefore("c/x", "c.txt") || walkBefore("c.txt", "c/x") || !walkBefore("c", "c/x") {
+		t.Error("walkBefore does not follow WalkDir order")
+	}
+}
+
+func TestContinuationPromptFileState(t *testing.T) {
+	run := &fileSnapshot{Files: map[string]fileState{"a.txt": {Hash: "1"}}}
+	prev := &fileSnapshot{Files: map[string]fileState{"a.txt": {Hash: "2"}}}
+	cur := &fileSnapshot{Files: map[string]fileState{"a.txt": {Hash: "2"}, "b.txt": {Hash: "3"}}}
+
+	d := newPromptData(2, 0, "task")
+	d.setFileState(run, prev, cur)
+	got, _, err := buildContinuationPrompt(testTemplates(t), d, "handoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"(not a git repository; files compared by content",
+		"Files changed by the previous session:\n```\nA b.txt\n```",
+		"Files changed since the run started:\n```\nM a.txt\nA b.txt\n```",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt missing %q:\n%s", want, got)
+		}
+	}
+}
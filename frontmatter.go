@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Handoff statuses reported in the front-matter.
+const (
+	statusInProgress   = "in-progress"
+	statusBlocked      = "blocked"
+	statusBelievedDone = "believed-done"
+)
+
+// Test states reported in the front-matter.
+const (
+	testsPassing = "passing"
+	testsFailing = "failing"
+	testsNotRun  = "not-run"
+)
+
+// maxBlockedSessions is how many consecutive sessions may report
+// "blocked" before the run stops.
+const maxBlockedSessions = 2
+
+// handoffFrontMatter is the machine-readable block at the top of a handoff:
+// a JSON object between two "---" lines.
+type handoffFrontMatter struct {
+	Status       string   `json:"status"`
+	NextSteps    []string `json:"next_steps,omitempty"`
+	FilesTouched []string `json:"files_touched,omitempty"`
+	Tests        string   `json:"tests,omitempty"`
+	FailingTests []string `json:"failing_tests,omitempty"`
+	Risks        []string `json:"risks,omitempty"`
+}
+
+// splitFrontMatter separates a leading "---" delimited block from the rest
+// of a handoff. ok is false if the handoff does not start with one.
+func splitFrontMatter(text string) (block, rest string, ok bool) {
+	lines := splitLines(strings.TrimLeft(text, " \t\r\n"))
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return "", text, false
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			return strings.Join(lines[1:i], "\n"), strings.Join(lines[i+1:], "\n"), true
+		}
+	}
+	return "", text, false
+}
+
+// parseFrontMatter decodes and validates a front-matter block.
+func parseFrontMatter(block string) (*handoffFrontMatter, error) {
+	var fm handoffFrontMatter
+	if err := json.Unmarshal([]byte(block), &fm); err != nil {
+		return nil, fmt.Errorf("not valid JSON: %v", err)
+	}
+	switch fm.Status {
+	case statusInProgress, statusBlocked, statusBelievedDone:
+	case "":
+		return nil, fmt.Errorf("status is missing")
+	default:
+		return nil, fmt.Errorf("unknown status %q (want %s, %s or %s)", fm.Status, statusInProgress, statusBlocked, statusBelievedDone)
+	}
+	switch fm.Tests {
+	case "", testsPassing, testsFailing, testsNotRun:
+	default:
+		return nil, fmt.Errorf("unknown tests value %q (want %s, %s or %s)", fm.Tests, testsPassing, testsFailing, testsNotRun)
+	}
+	return &fm, nil
+}
+
+// status returns the front-matter status of a handoff, or "".
+func (h *parsedHandoff) status() string {
+	if h == nil || h.FrontMatter == nil {
+		return ""
+	}
+	return h.FrontMatter.Status
+}
+
+// summary is a one-line description for the log and the run history,
+// e.g. "in-progress, tests failing, 3 next steps, 1 risk".
+func (fm *handoffFrontMatter) summary() string {
+	parts := []string{fm.Status}
+	if fm.Tests != "" {
+		parts = append(parts, "tests "+fm.Tests)
+	}
+	if n := len(fm.NextSteps); n > 0 {
+		parts = append(parts, plural(n, "next step"))
+	}
+	if n := len(fm.FilesTouched); n > 0 {
+		parts = append(parts, plural(n, "file")+" touched")
+	}
+	if n := len(fm.Risks); n > 0 {
+		parts = append(parts, plural(n, "risk"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// statusHistory lists the front-matter status of each session that wrote
+// a handoff, e.g. "s1 in-progress → s2 believed-done".
+func (m *runManifest) statusHistory() string {
+	var parts []string
+	for _, s := range m.Sessions {
+		if status := s.Handoff.status(); status != "" {
+			parts = append(parts, fmt.Sprintf("s%d %s", s.Number, status))
+		}
+	}
+	return strings.Join(parts, " → ")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		wantBlock string
+		wantRest  string
+		wantOK    bool
+	}{
+		{"front-matter", "---\n{\"status\": \"blocked\"}\n---\n## Q0\nstate", `{"status": "blocked"}`, "## Q0\nstate", true},
+		{"leading blank lines", "\n\n---\n{}\n---\nrest", "{}", "rest", true},
+		{"multi-line block", "---\n{\n  \"status\": \"in-progress\"\n}\n---\n", "{\n  \"status\": \"in-progress\"\n}", "", true},
+		{"none", "## Q0\nstate", "", "## Q0\nstate", false},
+		{"unterminated", "---\n{}\n## Q0", "", "---\n{}\n## Q0", false},
+		{"rule later in the text", "## Q0\n---\nstate", "", "## Q0\n---\nstate", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, rest, ok := splitFrontMatter(tt.in)
+			if block != tt.wantBlock || rest != tt.wantRest || ok != tt.wantOK {
+				t.Errorf("splitFrontMatter = (%q, %q, %v), want (%q, %q, %v)", block, rest, ok, tt.wantBlock, tt.wantRest, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	fm, err := parseFrontMatter(`{"status": "in-progress", "next_steps": ["a", "b"], "files_touched": ["x.go"], "tests": "failing", "failing_tests": ["TestX"], "risks": ["r"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fm.summary(); got != "in-progress, tests failing, 2 next steps, 1 file touched, 1 risk" {
+		t.Errorf("summary() = %q", got)
+	}
+
+	for _, bad := range []string{
+		`{"status": "done"}`,
+		`{"next_steps": []}`,
+		`{"status": "blocked", "tests": "green"}`,
+		`status: blocked`,
+	} {
+		if _, err := parseFrontMatter(bad); err == nil {
+			t.Errorf("parseFrontMatter(%s): expected an error", bad)
+		}
+	}
+}
+
+func TestParseHandoffFrontMatter(t *testing.T) {
+	h := parseHandoff("---\n{\"status\": \"believed-done\", \"files_touched\": [\"a.go\", \"b.go\", \"c.go\"]}\n---\n## Q0: State\nDone.\n")
+	if h.status() != statusBelievedDone {
+		t.Errorf("status() = %q", h.status())
+	}
+	if len(h.Violations) != 0 {
+		t.Errorf("files in the front-matter are not a violation: %+v", h.Violations)
+	}
+	if got := h.text(); got != "## Q0: State\nDone." {
+		t.Errorf("text() = %q", got)
+	}
+
+	h = parseHandoff("---\n{\"status\": \"finished\"}\n---\n## Q0\nstate")
+	if h.FrontMatter != nil || len(h.Violations) != 1 || h.Violations[0].Rule != "front-matter" {
+		t.Errorf("invalid front-matter: FrontMatter = %+v, Violations = %+v", h.FrontMatter, h.Violations)
+	}
+
+	var none *parsedHandoff
+	if none.status() != "" {
+		t.Error("nil handoff should have no status")
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	m := &runManifest{Sessions: []sessionRecord{
+		{Number: 1, Handoff: parseHandoff("---\n{\"status\": \"in-progress\"}\n---\n## Q0\nx")},
+		{Number: 2, Outcome: "crashed"},
+		{Number: 3, Handoff: parseHandoff("---\n{\"status\": \"believed-done\"}\n---\n## Q0\nx")},
+	}}
+	if got := m.statusHistory(); !strings.Contains(got, "s1 in-progress → s3 believed-done") {
+		t.Errorf("statusHistory() = %q", got)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caps on the git state pasted into continuation prompts.
+const (
+	maxDiffStatFiles = 40
+	maxRunCommits    = 30
+)
+
+// maxUntrackedSnapshotSize caps the untracked files copied into a
+// snapshot: larger ones (build output, datasets, core dumps) would
+// otherwise be written to .git/objects on every snapshot.
+const maxUntrackedSnapshotSize = 10 << 20
+
+// gitSnapshot is the repository state at a point in time: HEAD and a tree
+// object holding the whole working tree, untracked files included
+// (ignored files excluded).
+type gitSnapshot struct {
+	Head string    `json:"head,omitempty"` // "" before the first commit
+	Tree string    `json:"tree"`
+	At   time.Time `json:"at"`
+
+	// Skipped are the untracked files over maxUntrackedSnapshotSize that
+	// Tree leaves out.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// takeGitSnapshot records the working tree without touching the index or
+// any ref: files are staged into a copy of the index and written as a
+// tree. It returns nil outside a git repository.
+func takeGitSnapshot() *gitSnapshot {
+	if runGit("rev-parse", "--is-inside-work-tree") != "true" {
+		return nil
+	}
+	tree, skipped, err := snapshotTree()
+	if err != nil {
+		errMsg("Failed to snapshot the working tree: %v", err)
+		return nil
+	}
+	if len(skipped) > 0 {
+		names := strings.Join(skipped, ", ")
+		if len(skipped) > 5 {
+			names = strings.Join(skipped[:5], ", ") + fmt.Sprintf(" and %d more", len(skipped)-5)
+		}
+		logMsg("Left %d untracked file(s) over %d MiB out of the snapshot: %s",
+			len(skipped), maxUntrackedSnapshotSize>>20, names)
+	}
+	return &gitSnapshot{
+		Head:    runGit("rev-parse", "--verify", "--quiet", "HEAD"),
+		Tree:    tree,
+		At:      time.Now(),
+		Skipped: skipped,
+	}
+}
+
+// snapshotTree writes the working tree as a tree object. The real index
+// is copied first so that unchanged files are not hashed again. Untracked
+// files over maxUntrackedSnapshotSize are left out and returned in skipped.
+func snapshotTree() (tree string, skipped []string, err error) {
+	tmp, err := os.MkdirTemp("", "icc-index-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(tmp)
+	index := filepath.Join(tmp, "index")
+	if real := runGit("rev-parse", "--git-path", "index"); real != "" {
+		copyFile(real, index) // a missing index just means an empty start
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + index, "GIT_LITERAL_PATHSPECS=1"}
+	if _, err := gitEnv(env, "add", "-u"); err != nil {
+		return "", nil, err
+	}
+	untracked, err := gitEnv(env, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return "", nil, err
+	}
+	top := runGit("rev-parse", "--show-toplevel")
+	var add strings.Builder
+	for _, path := range strings.Split(untracked, "\x00") {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Lstat(filepath.Join(top, path)); err == nil && info.Size() > maxUntrackedSnapshotSize {
+			skipped = append(skipped, path)
+			continue
+		}
+		add.WriteString(path + "\x00")
+	}
+	if add.Len() > 0 {
+		if _, err := gitEnvInput(env, add.String(), "add", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+			return "", nil, err
+		}
+	}
+	tree, err = gitEnv(env, "write-tree")
+	return tree, skipped, err
+}
+
+// gitEnv runs git at the top of the work tree with extra environment
+// variables and returns its trimmed output.
+func gitEnv(env []string, args ...string) (string, error) {
+	return gitEnvInput(env, "", args...)
+}
+
+// gitEnvInput is gitEnv with input on git's stdin.
+func gitEnvInput(env []string, input string, args ...string) (string, error) {
+	top := runGit("rev-parse", "--show-toplevel")
+	cmd := exec.Command("git", append([]string{"-C", top}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// snapshotDiffStat summarizes the changes between two snapshots, listing
+// at most maxDiffStatFiles files.
+func snapshotDiffStat(from, to *gitSnapshot) string {
+	if from == nil || to == nil {
+		return ""
+	}
+	if from.Tree == to.Tree {
+		return "(no changes)"
+	}
+	return runGit("diff", "--stat-count="+strconv.Itoa(maxDiffStatFiles), from.Tree, to.Tree)
+}
+
+// commitsSince lists the commits on HEAD made after base, newest first,
+// at most maxRunCommits of them.
+func commitsSince(base *gitSnapshot) string {
+	if base == nil {
+		return ""
+	}
+	head := runGit("rev-parse", "--verify", "--quiet", "HEAD")
+	if head == "" || head == base.Head {
+		return "(no commits)"
+	}
+	revs := "HEAD"
+	if base.Head != "" {
+		revs = base.Head + "..HEAD"
+	}
+	log := runGit("log", "--oneline", "--no-decorate", "-n", strconv.Itoa(maxRunCommits), revs)
+	total, _ := strconv.Atoi(runGit("rev-list", "--count", revs))
+	if more := total - maxRunCommits; more > 0 {
+		log += fmt.Sprintf("\n... and %d earlier commits", more)
+	}
+	return log
+}
+
+// setGitState fills the git fields of the continuation prompt: run is the
+// snapshot at run start, prev at the previous session's start and cur now.
+func (d *promptData) setGitState(run, prev, cur *gitSnapshot) {
+	if cur == nil {
+		d.GitRepo = false
+		return
+	}
+	d.GitRepo = true
+	d.RunDiff = snapshotDiffStat(run, cur)
+	d.SessionDiff = snapshotDiffStat(prev, cur)
+	d.RunCommits = commitsSince(run)
+	d.GitStatus = capLines(runGit("status", "--short"), maxDiffStatFiles)
+}
+
+// headSnapshot describes the last commit as a snapshot, for previews
+// outside a run. It returns nil without commits.
+func headSnapshot() *gitSnapshot {
+	head := runGit("rev-parse", "--verify", "--quiet", "HEAD")
+	if head == "" {
+		return nil
+	}
+	return &gitSnapshot{Head: head, Tree: runGit("rev-parse", "HEAD^{tree}")}
+}
+
+// capLines keeps the first max lines of s, noting how many were cut.
+func capLines(s string, max int) string {
+	lines := splitLines(s)
+	if len(lines) <= max {
+		return s
+	}
+	return strings.Join(lines[:max], "\n") + fmt.Sprintf("\n... and %d more", len(lines)-max)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initTestRepo creates an empty git repository and makes it the working
+// directory for the rest of the test.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	gitTest(t, "init", "-q")
+	return dir
+}
+
+func gitTest(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestGitSnapshot(t *testing.T) {
+	dir := initTestRepo(t)
+
+	base := takeGitSnapshot()
+	if base == nil || base.Head != "" || base.Tree == "" {
+		t.Fatalf("snapshot of an empty repository = %+v", base)
+	}
+	if got := commitsSince(base); got != "(no commits)" {
+		t.Errorf("commitsSince = %q", got)
+	}
+
+	writeTestFile(filepath.Join(dir, "a.txt"), "one\n")
+	writeTestFile(filepath.Join(dir, "ignored.log"), "noise\n")
+	writeTestFile(filepath.Join(dir, ".gitignore"), "*.log\n")
+	s1 := takeGitSnapshot()
+	stat := snapshotDiffStat(base, s1)
+	if !strings.Contains(stat, "a.txt") || strings.Contains(stat, "ignored.log") {
+		t.Errorf("diff stat since base:\n%s", stat)
+	}
+	if got := gitTest(t, "status", "--short"); !strings.Contains(got, "?? a.txt") {
+		t.Errorf("snapshot must not stage files, status:\n%s", got)
+	}
+	if got := snapshotDiffStat(s1, takeGitSnapshot()); got != "(no changes)" {
+		t.Errorf("unchanged tree: %q", got)
+	}
+
+	gitTest(t, "add", "-A")
+	gitTest(t, "commit", "-q", "-m", "first commit")
+	writeTestFile(filepath.Join(dir, "b.txt"), "two\n")
+	s2 := takeGitSnapshot()
+	if s2.Head == "" {
+		t.Error("snapshot should record HEAD")
+	}
+	if stat := snapshotDiffStat(s1, s2); !strings.Contains(stat, "b.txt") || strings.Contains(stat, "a.txt") {
+		t.Errorf("diff stat of the session:\n%s", stat)
+	}
+	if got := commitsSince(base); !strings.Contains(got, "first commit") {
+		t.Errorf("commitsSince(base) = %q", got)
+	}
+	if got := commitsSince(s2); got != "(no commits)" {
+		t.Errorf("commitsSince(s2) = %q", got)
+	}
+
+	var d promptData
+	d.setGitState(base, s1, s2)
+	if !d.GitRepo || !strings.Contains(d.RunDiff, "a.txt") || !strings.Contains(d.GitStatus, "?? b.txt") {
+		t.Errorf("setGitState = %+v", d)
+	}
+}
+
+func TestGitSnapshotSkipsLargeUntracked(t *testing.T) {
+	dir := initTestRepo(t)
+	writeTestFile(filepath.Join(dir, "small.txt"), "small\n")
+	big := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(big, make([]byte, maxUntrackedSnapshotSize+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, skipped, err := snapshotTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || skipped[0] != "big.bin" {
+		t.Errorf("skipped = %v, want [big.bin]", skipped)
+	}
+	files := gitTest(t, "ls-tree", "--name-only", tree)
+	if !strings.Contains(files, "small.txt") || strings.Contains(files, "big.bin") {
+		t.Errorf("snapshot tree holds:\n%s", files)
+	}
+	if got := strings.TrimSpace(gitTest(t, "count-objects")); !strings.HasPrefix(got, "2 objects") {
+		t.Errorf("objects written: %q, want the small blob and the tree", got)
+	}
+
+	// Once tracked, a large file is snapshotted like any other.
+	gitTest(t, "add", "big.bin")
+	if _, skipped, _ := snapshotTree(); len(skipped) != 0 {
+		t.Errorf("tracked file skipped: %v", skipped)
+	}
+}
+
+func TestGitSnapshotOutsideRepo(t *testing.T) {
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(wd) })
+	if s := takeGitSnapshot(); s != nil {
+		t.Errorf("snapshot outside a repository = %+v", s)
+	}
+	var d promptData
+	d.setGitState(nil, nil, nil)
+	if d.GitRepo {
+		t.Error("GitRepo should be false outside a repository")
+	}
+}
+
+func TestCapLines(t *testing.T) {
+	if got := capLines("a\nb", 2); got != "a\nb" {
+		t.Errorf("got %q", got)
+	}
+	if got := capLines("a\nb\nc\nd", 2); got != "a\nb\n... and 2 more" {
+		t.Errorf("got %q", got)
+	}
+}
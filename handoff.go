@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// handoffSection names a section of the Q0–Q4 handoff format.
+type handoffSection struct {
+	ID    string // "Q0"
+	Title string // short description used in messages
+}
+
+// handoffSections is the Q0–Q4 format in order.
+var handoffSections = []handoffSection{
+	{"Q0", "project state"},
+	{"Q1", "next step"},
+	{"Q2", "dead ends"},
+	{"Q3", "decisions"},
+	{"Q4", "uncertainties"},
+}
+
+// requiredHandoffSections must be present and non-empty in every handoff.
+// The others may be skipped when there is nothing to say.
+var requiredHandoffSections = []handoffSection{
+	{"Q0", "project state"},
+}
+
+var handoffHeadingRe = regexp.MustCompile(`^#{1,6}\s*(Q[0-9])\b`)
+
+var (
+	// noneAnswerRe matches a section answered with "None" and the like,
+	// which the rules ask agents to skip instead.
+	noneAnswerRe = regexp.MustCompile(`(?i)^[-*\s]*(none|n/?a|nothing|no|nothing to report|none so far)[.!]?$`)
+
+	// fileListHeadingRe matches a heading introducing a list of changed
+	// files or completed work; the supervisor injects git state instead.
+	fileListHeadingRe = regexp.MustCompile(`(?i)^#{1,6}\s*(files?\s+(modified|changed|touched|created)|(modified|changed|touched|created)\s+files|completed\s+work|work\s+completed|changes\s+made)\b`)
+
+	// fileLineRe matches a list item that is just a file path, optionally
+	// followed by a short note.
+	fileLineRe = regexp.MustCompile("^\\s*[-*+]\\s+`?[\\w./-]*\\w\\.[a-zA-Z0-9]{1,5}`?\\s*([-—:(].*)?$")
+)
+
+// minFileListLines is how many path-only list items make a file listing.
+const minFileListLines = 3
+
+// handoffPart is one Q section of a handoff.
+type handoffPart struct {
+	ID      string `json:"id"`      // "Q0"
+	Heading string `json:"heading"` // the heading line as written
+	Body    string `json:"body"`
+}
+
+// handoffViolation is a broken handoff rule.
+type handoffViolation struct {
+	Section string `json:"section,omitempty"` // "" when not tied to a Q section
+	Rule    string `json:"rule"`              // "none-answer", "lists-files" or "front-matter"
+	Detail  string `json:"detail"`
+}
+
+// parsedHandoff is a handoff split into its Q sections and checked against
+// the protocol.
+type parsedHandoff struct {
+	FrontMatter *handoffFrontMatter `json:"front_matter,omitempty"`
+	Preamble    string              `json:"preamble,omitempty"` // text before the first Q section
+	Sections    []handoffPart       `json:"sections,omitempty"`
+	Missing     []string            `json:"missing,omitempty"` // required sections absent or empty, e.g. "Q0 (project state)"
+	Empty       []string            `json:"empty,omitempty"`   // sections with a heading but no answer
+	Violations  []handoffViolation  `json:"violations,omitempty"`
+
+	raw string
+}
+
+// parseHandoff splits a handoff into its front-matter and sections and
+// validates it. A section heading repeated later is merged into the first.
+func parseHandoff(text string) *parsedHandoff {
+	h := &parsedHandoff{raw: strings.TrimSpace(text)}
+	if block, rest, ok := splitFrontMatter(text); ok {
+		fm, err := parseFrontMatter(block)
+		if err != nil {
+			h.Violations = append(h.Violations, handoffViolation{Rule: "front-matter", Detail: err.Error()})
+		}
+		h.FrontMatter = fm
+		text = rest
+		h.raw = strings.TrimSpace(rest)
+	}
+	var preamble []string
+	index := map[string]int{}
+	current := -1
+	for _, line := range splitLines(text) {
+		trimmed := strings.TrimSpace(line)
+		if m := handoffHeadingRe.FindStringSubmatch(trimmed); m != nil {
+			if j, ok := index[m[1]]; ok {
+				current = j
+				continue
+			}
+			index[m[1]] = len(h.Sections)
+			current = len(h.Sections)
+			h.Sections = append(h.Sections, handoffPart{ID: m[1], Heading: trimmed})
+			continue
+		}
+		if fileListHeadingRe.MatchString(trimmed) {
+			h.Violations = append(h.Violations, handoffViolation{Section: sectionID(h.Sections, current), Rule: "lists-files", Detail: trimmed})
+		}
+		if current < 0 {
+			preamble = append(preamble, line)
+		} else {
+			h.Sections[current].Body += line + "\n"
+		}
+	}
+	h.Preamble = strings.TrimSpace(strings.Join(preamble, "\n"))
+
+	for i := range h.Sections {
+		s := &h.Sections[i]
+		s.Body = strings.TrimSpace(s.Body)
+		switch {
+		case s.Body == "":
+			h.Empty = append(h.Empty, s.ID)
+		case noneAnswerRe.MatchString(s.Body):
+			h.Violations = append(h.Violations, handoffViolation{Section: s.ID, Rule: "none-answer", Detail: fmt.Sprintf("answered %q; skip the section instead", s.Body)})
+		}
+		if n := countFileLines(s.Body); n >= minFileListLines {
+			h.Violations = append(h.Violations, handoffViolation{Section: s.ID, Rule: "lists-files", Detail: fmt.Sprintf("%d lines listing files", n)})
+		}
+	}
+	if n := countFileLines(h.Preamble); n >= minFileListLines {
+		h.Violations = append(h.Violations, handoffViolation{Rule: "lists-files", Detail: fmt.Sprintf("%d lines listing files", n)})
+	}
+
+	for _, req := range requiredHandoffSections {
+		if h.answer(req.ID) == "" {
+			h.Missing = append(h.Missing, fmt.Sprintf("%s (%s)", req.ID, req.Title))
+		}
+	}
+	return h
+}
+
+func sectionID(sections []handoffPart, i int) string {
+	if i < 0 {
+		return ""
+	}
+	return sections[i].ID
+}
+
+func countFileLines(body string) int {
+	n := 0
+	for _, line := range splitLines(body) {
+		if fileLineRe.MatchString(line) {
+			n++
+		}
+	}
+	return n
+}
+
+// section returns the section with the given ID, or nil.
+func (h *parsedHandoff) section(id string) *handoffPart {
+	for i := range h.Sections {
+		if h.Sections[i].ID == id {
+			return &h.Sections[i]
+		}
+	}
+	return nil
+}
+
+// answer returns the body of a section if it holds a real answer: not
+// missing, empty or "None".
+func (h *parsedHandoff) answer(id string) string {
+	s := h.section(id)
+	if s == nil || noneAnswerRe.MatchString(s.Body) {
+		return ""
+	}
+	return s.Body
+}
+
+// problems lists everything wrong with the handoff, one line each.
+func (h *parsedHandoff) problems() []string {
+	var out []string
+	for _, m := range h.Missing {
+		out = append(out, "missing required section "+m)
+	}
+	for _, id := range h.Empty {
+		if isRequiredSection(id) {
+			continue // reported as missing
+		}
+		out = append(out, id+": empty section; remove the heading or answer it")
+	}
+	for _, v := range h.Violations {
+		where := v.Section
+		if where == "" {
+			where = "(outside Q sections)"
+		}
+		out = append(out, fmt.Sprintf("%s: %s: %s", where, v.Rule, v.Detail))
+	}
+	return out
+}
+
+// text reassembles the handoff from its answered sections, in Q order,
+// dropping empty and "None" sections. A handoff without Q sections or
+// missing a required one is returned as written, so that nothing the
+// agent wrote is lost.
+func (h *parsedHandoff) text() string {
+	if len(h.Sections) == 0 || len(h.Missing) > 0 {
+		return h.raw
+	}
+	var parts []string
+	if h.Preamble != "" {
+		parts = append(parts, h.Preamble)
+	}
+	for _, known := range handoffSections {
+		if s := h.section(known.ID); s != nil && h.answer(known.ID) != "" {
+			parts = append(parts, s.Heading+"\n"+s.Body)
+		}
+	}
+	for _, s := range h.Sections {
+		if !isKnownSection(s.ID) && s.Body != "" {
+			parts = append(parts, s.Heading+"\n"+s.Body)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func isKnownSection(id string) bool {
+	return hasSection(handoffSections, id)
+}
+
+func isRequiredSection(id string) bool {
+	return hasSection(requiredHandoffSections, id)
+}
+
+func hasSection(sections []handoffSection, id string) bool {
+	for _, s := range sections {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// logHandoffSummary prints which sections a handoff answered, its
+// problems and the start of Q0.
+func logHandoffSummary(h *parsedHandoff) {
+	var answered []string
+	for _, s := range h.Sections {
+		if h.answer(s.ID) != "" {
+			answered = append(answered, s.ID)
+		}
+	}
+	if len(answered) == 0 {
+		answered = []string{"(none)"}
+	}
+	logMsg("Handoff sections: %s", strings.Join(answered, " "))
+	if h.FrontMatter != nil {
+		logMsg("Handoff status: %s", h.FrontMatter.summary())
+	}
+	for _, p := range h.problems() {
+		errMsg("Handoff: %s", p)
+	}
+	lines := splitLines(h.answer("Q0"))
+	for j := 0; j < 3 && j < len(lines); j++ {
+		fmt.Printf("  %s\n", lines[j])
+	}
+}
+
+// handoffMissingSections returns the required sections that are absent or
+// empty in a handoff, formatted as "Q0 (project state)".
+func handoffMissingSections(text string) []string {
+	return parseHandoff(text).Missing
+}
+
+// incompleteHandoffMessage is sent to a still-running agent whose handoff
+// file lacks required sections.
+func incompleteHandoffMessage(handoffPath string, missing []string) string {
+	return fmt.Sprintf(`[ICC SUPERVISOR] Your handoff file at %s is incomplete. Missing or empty: %s.
+Update the file now with the Edit or Write tool so it contains these sections, following the format in the system instructions. Do nothing else.`,
+		handoffPath, strings.Join(missing, ", "))
+}
+
+// runHandoff implements 'icc handoff lint <file>...', which checks handoff
+// files against the protocol and exits non-zero if any has problems.
+func runHandoff(args []string) {
+	if len(args) < 2 || args[0] != "lint" {
+		fmt.Fprintln(os.Stderr, "Usage: icc handoff lint FILE...")
+		os.Exit(1)
+	}
+	failed := false
+	for _, path := range args[1:] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errMsg("%v", err)
+			failed = true
+			continue
+		}
+		problems := parseHandoff(string(data)).problems()
+		if len(problems) == 0 {
+			okMsg("%s: ok", path)
+			continue
+		}
+		failed = true
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", path, p)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
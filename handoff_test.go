@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandoffMissingSections(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"complete", "## Q0: What is the current state?\nA REST API, half done.\n\n## Q1: Next?\nAdd tests.", nil},
+		{"q0 only", "## Q0: State\nAll good.", nil},
+		{"missing q0", "## Q1: Next?\nAdd tests.", []string{"Q0 (project state)"}},
+		{"empty q0", "## Q0: State\n\n## Q1: Next?\nAdd tests.", []string{"Q0 (project state)"}},
+		{"empty file", "", []string{"Q0 (project state)"}},
+		{"other heading level", "### Q0 - state\nsomething", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := handoffMissingSections(tt.in)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("handoffMissingSections = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncompleteHandoffMessage(t *testing.T) {
+	got := incompleteHandoffMessage("/tmp/icc-handoff-abc.md", []string{"Q0 (project state)"})
+	for _, want := range []string{"/tmp/icc-handoff-abc.md", "Q0 (project state)", "ICC SUPERVISOR"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message missing %q", want)
+		}
+	}
+}
+
+func TestParseHandoff(t *testing.T) {
+	t.Run("splits sections", func(t *testing.T) {
+		h := parseHandoff("HANDOFF\n\n## Q0: State?\nA CLI, half done.\n\n## Q1: Next?\nAdd tests.\n## Q4: Unsure?\n")
+		if h.Preamble != "HANDOFF" {
+			t.Errorf("Preamble = %q", h.Preamble)
+		}
+		if len(h.Sections) != 3 {
+			t.Fatalf("got %d sections, want 3", len(h.Sections))
+		}
+		if got := h.answer("Q1"); got != "Add tests." {
+			t.Errorf("Q1 = %q", got)
+		}
+		if strings.Join(h.Empty, ",") != "Q4" {
+			t.Errorf("Empty = %v, want [Q4]", h.Empty)
+		}
+		if len(h.Missing) != 0 || len(h.Violations) != 0 {
+			t.Errorf("unexpected problems: %v", h.problems())
+		}
+	})
+
+	t.Run("repeated heading is merged", func(t *testing.T) {
+		h := parseHandoff("## Q0\nfirst\n## Q1\nnext\n## Q0 again\nsecond")
+		if got := h.answer("Q0"); got != "first\nsecond" {
+			t.Errorf("Q0 = %q", got)
+		}
+	})
+
+	t.Run("none answer", func(t *testing.T) {
+		h := parseHandoff("## Q0\nstate\n## Q2: Dead ends?\nNone.")
+		if len(h.Violations) != 1 || h.Violations[0].Rule != "none-answer" || h.Violations[0].Section != "Q2" {
+			t.Errorf("Violations = %+v", h.Violations)
+		}
+		if h.answer("Q2") != "" {
+			t.Error("a None answer should not count as an answer")
+		}
+	})
+
+	t.Run("none answer for Q0 is missing", func(t *testing.T) {
+		h := parseHandoff("## Q0\nN/A")
+		if strings.Join(h.Missing, ",") != "Q0 (project state)" {
+			t.Errorf("Missing = %v", h.Missing)
+		}
+	})
+
+	t.Run("file listing", func(t *testing.T) {
+		h := parseHandoff("## Q0\nAPI done.\n- `main.go` — entry\n- api/handler.go\n- api/handler_test.go: tests\n")
+		if len(h.Violations) != 1 || h.Violations[0].Rule != "lists-files" {
+			t.Errorf("Violations = %+v", h.Violations)
+		}
+	})
+
+	t.Run("file list heading", func(t *testing.T) {
+		h := parseHandoff("## Q0\nstate\n\n### Files modified\n- main.go")
+		if len(h.Violations) != 1 || h.Violations[0].Section != "Q0" {
+			t.Errorf("Violations = %+v", h.Violations)
+		}
+	})
+
+	t.Run("prose mentioning files is fine", func(t *testing.T) {
+		h := parseHandoff("## Q1\n- Fix the parser in parse.go, it drops quotes\n- Then run the tests\n- Check go.mod")
+		if len(h.Violations) != 0 {
+			t.Errorf("Violations = %+v", h.Violations)
+		}
+	})
+}
+
+func TestParsedHandoffText(t *testing.T) {
+	t.Run("answered sections in order", func(t *testing.T) {
+		got := parseHandoff("## Q1: Next\nAdd tests.\n## Q0: State\nHalf done.\n## Q2: Dead ends\nNone\n## Q3: Decisions\n").text()
+		want := "## Q0: State\nHalf done.\n\n## Q1: Next\nAdd tests."
+		if got != want {
+			t.Errorf("text() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid handoff is kept as written", func(t *testing.T) {
+		in := "## Q1: Next\nAdd tests.\n## Q2\nNone"
+		if got := parseHandoff(in).text(); got != in {
+			t.Errorf("text() = %q, want the input", got)
+		}
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		if got := parseHandoff("  just notes \n").text(); got != "just notes" {
+			t.Errorf("text() = %q", got)
+		}
+	})
+}
+
+func TestHandoffProblems(t *testing.T) {
+	got := parseHandoff("## Q0\n\n## Q1\n\n## Q2\nnone").problems()
+	want := []string{
+		"missing required section Q0 (project state)",
+		"Q1: empty section; remove the heading or answer it",
+		`Q2: none-answer: answered "none"; skip the section instead`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// handoffRequestFile marks a manual handoff request in the run directory.
+// It holds the handoff path the request was made for, so a stale request
+// from an earlier session is not attributed to a later one.
+const handoffRequestFile = "handoff-request"
+
+// manualHandoffMessage is pasted into the pane by 'icc handoff-now'.
+func manualHandoffMessage(handoffPath string) string {
+	return fmt.Sprintf(`[ICC SUPERVISOR] The operator has requested an immediate handoff. Stop your current work now and do not start anything new.
+Write the handoff file to %s right away (ICC_HANDOFF_PATH, format in the system instructions). Describe the state exactly as it is, including anything half-finished.`,
+		handoffPath)
+}
+
+// runHandoffNow implements 'icc handoff-now <run>': it asks the agent of a
+// running TTY run to write its handoff immediately. The supervisor's normal
+// detection then relays to a fresh session.
+func runHandoffNow(args []string) {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Usage: icc handoff-now <run>")
+		os.Exit(1)
+	}
+	run, err := loadRun(args[0])
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
+	}
+	if run.Mode != "tty" || run.Pane == "" || run.HandoffPath == "" {
+		errMsg("Run %s has no TTY session to hand off", run.ID)
+		os.Exit(1)
+	}
+	if fileExists(run.HandoffPath) {
+		okMsg("Run %s has already written its handoff: %s", run.ID, run.HandoffPath)
+		return
+	}
+	if err := tmuxCmd("has-session", "-t", run.ID); err != nil {
+		errMsg("tmux session %s is not running", run.ID)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(filepath.Join(run.Dir, handoffRequestFile), []byte(run.HandoffPath+"\n"), 0600); err != nil {
+		errMsg("Failed to record the request: %v", err)
+		os.Exit(1)
+	}
+	// Escape interrupts the current turn so the request is handled now
+	// rather than queued behind whatever the agent is doing.
+	tmuxSendKeys(run.Pane, "Escape")
+	time.Sleep(500 * time.Millisecond)
+	sendPrompt(run.Pane, manualHandoffMessage(run.HandoffPath))
+	okMsg("Handoff requested for run %s (target %s)", run.ID, run.HandoffPath)
+}
+
+// handoffRequested reports whether a manual handoff was requested for the
+// session writing to handoffPath.
+func handoffRequested(runDir, handoffPath string) bool {
+	data, err := os.ReadFile(filepath.Join(runDir, handoffRequestFile))
+	return err == nil && strings.TrimSpace(string(data)) == handoffPath
+}
+
+// bindHandoffKey tags the tmux session as an icc run and binds prefix+key
+// to 'icc handoff-now' for it. Key tables are global to the tmux server, so
+// the binding checks the session tag and does nothing elsewhere, and the
+// returned restore puts back what the key was bound to before. A binding
+// made by another icc run is left for that run to restore.
+func bindHandoffKey(tmuxSession, key string) (restore func()) {
+	exe, err := os.Executable()
+	if err != nil {
+		return func() {}
+	}
+	out, _ := exec.Command("tmux", "list-keys", "-T", "prefix").Output()
+	previous := keyBinding(string(out), "prefix", key)
+
+	tmuxCmd("set-option", "-t", tmuxSession, "@icc_run", tmuxSession)
+	tmuxCmd("set-option", "-t", tmuxSession, "@icc_runs_dir", runsDir())
+	tmuxCmd("bind-key", "-T", "prefix", key, "if-shell", "-F", "#{@icc_run}",
+		fmt.Sprintf(`run-shell "ICC_RUNS_DIR='#{@icc_runs_dir}' '%s' handoff-now '#{@icc_run}'"`, exe))
+
+	return func() {
+		switch {
+		case strings.Contains(previous, "handoff-now"):
+		case previous == "":
+			tmuxCmd("unbind-key", "-T", "prefix", key)
+		default:
+			// list-keys prints bindings as tmux commands.
+			f, err := os.CreateTemp("", "icc-key-")
+			if err != nil {
+				return
+			}
+			f.WriteString(previous + "\n")
+			f.Close()
+			tmuxCmd("source-file", f.Name())
+			os.Remove(f.Name())
+		}
+	}
+}
+
+// keyBinding returns the line of 'tmux list-keys' output that binds key in
+// table, or "".
+func keyBinding(listKeys, table, key string) string {
+	for _, line := range splitLines(listKeys) {
+		f := strings.Fields(line)
+		for i := 0; i+2 < len(f); i++ {
+			if f[i] == "-T" {
+				if f[i+1] == table && f[i+2] == key {
+					return strings.TrimSpace(line)
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManualHandoffMessage(t *testing.T) {
+	got := manualHandoffMessage("/tmp/icc-handoff-abc.md")
+	for _, want := range []string{"/tmp/icc-handoff-abc.md", "ICC SUPERVISOR", "immediate handoff"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message missing %q", want)
+		}
+	}
+}
+
+func TestHandoffRequested(t *testing.T) {
+	dir := t.TempDir()
+	if handoffRequested(dir, "/tmp/icc-handoff-a.md") {
+		t.Error("expected false without a request")
+	}
+
+	writeTestFile(filepath.Join(dir, handoffRequestFile), "/tmp/icc-handoff-a.md\n")
+	if !handoffRequested(dir, "/tmp/icc-handoff-a.md") {
+		t.Error("expected true for the requested session")
+	}
+	if handoffRequested(dir, "/tmp/icc-handoff-b.md") {
+		t.Error("a request for an earlier session must not match a later one")
+	}
+}
+
+func TestKeyBinding(t *testing.T) {
+	listKeys := `bind-key    -T prefix       C-b                  send-prefix
+bind-key -r -T prefix       H                    resize-pane -L 5
+bind-key    -T root         H                    display-message root`
+	if got := keyBinding(listKeys, "prefix", "H"); got != "bind-key -r -T prefix       H                    resize-pane -L 5" {
+		t.Errorf("keyBinding = %q", got)
+	}
+	if got := keyBinding(listKeys, "prefix", "X"); got != "" {
+		t.Errorf("unbound key: %q", got)
+	}
+}
+
+func TestBindHandoffKeyRestores(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// A private tmux server for the test.
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Setenv("TMUX", "")
+	if err := tmuxCmd("new-session", "-d", "-s", "icc-test"); err != nil {
+		t.Skipf("cannot start tmux: %v", err)
+	}
+	defer tmuxCmd("kill-server")
+
+	binding := func(key string) string {
+		out, _ := exec.Command("tmux", "list-keys", "-T", "prefix").Output()
+		return keyBinding(string(out), "prefix", key)
+	}
+	tmuxCmd("bind-key", "-T", "prefix", "H", "display-message", "mine")
+
+	restore := bindHandoffKey("icc-test", "H")
+	if !strings.Contains(binding("H"), "handoff-now") {
+		t.Fatalf("H not bound to handoff-now: %q", binding("H"))
+	}
+	restore()
+	if got := binding("H"); !strings.Contains(got, "display-message mine") {
+		t.Errorf("previous binding not restored: %q", got)
+	}
+
+	restore = bindHandoffKey("icc-test", "F12")
+	restore()
+	if got := binding("F12"); got != "" {
+		t.Errorf("F12 still bound after restore: %q", got)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// hookStateMaxAge is how long the state of a transcript is kept after its
+// last update.
+const hookStateMaxAge = 7 * 24 * time.Hour
+
+// hookInput is the part of claude's hook payload the context guard reads.
+type hookInput struct {
+	Event          string `json:"hook_event_name"`
+	ToolName       string `json:"tool_name"`
+	TranscriptPath string `json:"transcript_path"`
+	ToolInput      struct {
+		FilePath string `json:"file_path"`
+		Command  string `json:"command"`
+	} `json:"tool_input"`
+}
+
+// hookOutput is the hook's reply: a PreToolUse denial or a PostToolUse
+// reminder.
+type hookOutput struct {
+	HookSpecificOutput hookSpecificOutput `json:"hookSpecificOutput"`
+}
+
+type hookSpecificOutput struct {
+	HookEventName            string `json:"hookEventName"`
+	PermissionDecision       string `json:"permissionDecision,omitempty"`
+	PermissionDecisionReason string `json:"permissionDecisionReason,omitempty"`
+	AdditionalContext        string `json:"additionalContext,omitempty"`
+}
+
+// hookAllowedTools are never denied: they are all the agent needs to write
+// the handoff.
+var hookAllowedTools = map[string]bool{
+	"Read":         true,
+	"Write":        true,
+	"Edit":         true,
+	"NotebookEdit": true,
+}
+
+// contextGuard decides the hook's reply for a tool call at the given
+// context usage, or nil to let it through silently:
+//
+//   - PreToolUse at or over critical: deny everything except the tools in
+//     hookAllowedTools and anything that touches the handoff path.
+//   - PostToolUse at or over warn: remind the agent how much is left.
+func contextGuard(in hookInput, usage, warn, critical int, handoffPath string) *hookOutput {
+	switch {
+	case in.Event == "PreToolUse" && usage >= critical:
+		if handoffPath != "" && (in.ToolInput.FilePath == handoffPath ||
+			in.ToolName == "Bash" && strings.Contains(in.ToolInput.Command, handoffPath)) {
+			return nil
+		}
+		if hookAllowedTools[in.ToolName] {
+			return nil
+		}
+		return &hookOutput{hookSpecificOutput{
+			HookEventName:      "PreToolUse",
+			PermissionDecision: "deny",
+			PermissionDecisionReason: fmt.Sprintf("Context %d tokens has exceeded the limit of %d. Only Read/Write/Edit are allowed. Output the handoff immediately (follow the format in the system instructions).",
+				usage, critical),
+		}}
+	case in.Event == "PostToolUse" && usage >= warn:
+		return &hookOutput{hookSpecificOutput{
+			HookEventName: "PostToolUse",
+			AdditionalContext: fmt.Sprintf("WARNING: Context has used %d tokens, approximately %d tokens remaining before the hard limit. Finish your current step as soon as possible, then output the handoff (follow the format in the system instructions).",
+				usage, critical-usage),
+		}}
+	}
+	return nil
+}
+
+// runHook implements 'icc hook', the context guard registered by 'icc
+// install' for PreToolUse and PostToolUse. It reads the hook payload from
+// stdin and prints its decision, if any, to stdout. It never fails the
+// tool call: on any error it prints nothing.
+func runHook() {
+	var in hookInput
+	if err := json.NewDecoder(os.Stdin).Decode(&in); err != nil || in.TranscriptPath == "" {
+		return
+	}
+	if runDir := os.Getenv("ICC_RUN_DIR"); runDir != "" {
+		recordTranscriptPath(runDir, in.TranscriptPath)
+	}
+	usage, err := transcriptUsage(in.TranscriptPath)
+	if err != nil {
+		return
+	}
+	out := contextGuard(in, usage,
+		envIntOrDefault("CTX_WARN_TOKENS", 175000),
+		envIntOrDefault("CTX_CRITICAL_TOKENS", 190000),
+		os.Getenv("ICC_HANDOFF_PATH"))
+	if out == nil {
+		return
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// hookStateDir holds the hook's scan state, one file per transcript: in
+// the user's cache directory, or a per-user directory under the temp dir
+// when there is none. ICC_HOOK_STATE_DIR overrides the default.
+func hookStateDir() string {
+	return envOrDefault("ICC_HOOK_STATE_DIR", userStateDir("hook-state"))
+}
+
+// userStateDir is icc's directory name for the current user's state:
+// under the user's cache directory, or a per-user directory under the temp
+// dir when there is none.
+func userStateDir(name string) string {
+	if cache, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cache, "icc", name)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("icc-%s-%d", name, os.Getuid()))
+}
+
+// privateDir reports whether dir is a real directory owned by the current
+// user that no one else can write to, or does not exist yet. State in a
+// directory another user could write is neither read nor written.
+func privateDir(dir string) bool {
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil || !info.IsDir() || info.Mode().Perm()&0022 != 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
+
+// hookStatePath is the state file of a transcript, named by a hash of its
+// path.
+func hookStatePath(transcript string) string {
+	sum := sha256.Sum256([]byte(transcript))
+	return filepath.Join(hookStateDir(), hex.EncodeToString(sum[:8])+".json")
+}
+
+// transcriptUsage returns the context usage of a transcript. The scanner
+// state (offset and usage) is kept between calls, so each call reads only
+// the lines appended since the previous one. Failing to keep the state
+// only costs a full scan next time.
+func transcriptUsage(transcript string) (int, error) {
+	path := hookStatePath(transcript)
+	private := privateDir(filepath.Dir(path))
+	s := usageScanner{Path: transcript}
+	if !private {
+		// Scan from the start, as if there were no state.
+	} else if data, err := os.ReadFile(path); err == nil {
+		var saved usageScanner
+		if json.Unmarshal(data, &saved) == nil && saved.Path == transcript {
+			s = saved
+		}
+	}
+	offset := s.Offset
+	if err := s.scan(); err != nil {
+		return 0, err
+	}
+	if private && s.Offset != offset {
+		saveHookState(path, s)
+	}
+	return s.Usage, nil
+}
+
+// saveHookState writes the state atomically: the PreToolUse and
+// PostToolUse hooks of parallel tool calls can run at the same time. The
+// first save for a transcript also removes state not updated within
+// hookStateMaxAge, left by transcripts that are gone or finished.
+func saveHookState(path string, s usageScanner) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		pruneHookState(dir, time.Now().Add(-hookStateMaxAge))
+	}
+	tmp, err := os.CreateTemp(dir, ".state-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if err := errors.Join(err, tmp.Close()); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// pruneHookState removes the state files in dir last written before cutoff,
+// including temp files left by an interrupted save.
+func pruneHookState(dir string, cutoff time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !(strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".state-")) {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
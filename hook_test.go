@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextGuard(t *testing.T) {
+	const handoff = "/tmp/icc-handoff-abc123.md"
+	call := func(event, tool, filePath, command string) hookInput {
+		var in hookInput
+		in.Event, in.ToolName = event, tool
+		in.ToolInput.FilePath, in.ToolInput.Command = filePath, command
+		return in
+	}
+	tests := []struct {
+		name  string
+		in    hookInput
+		usage int
+		want  string // "", "deny" or "warn"
+	}{
+		{"pre below critical", call("PreToolUse", "Bash", "", "ls"), 189999, ""},
+		{"pre at critical denies Bash", call("PreToolUse", "Bash", "", "ls"), 190000, "deny"},
+		{"pre at critical denies Grep", call("PreToolUse", "Grep", "", ""), 195000, "deny"},
+		{"pre at critical allows Read", call("PreToolUse", "Read", "/src/a.go", ""), 195000, ""},
+		{"pre at critical allows Edit", call("PreToolUse", "Edit", "/src/a.go", ""), 195000, ""},
+		{"pre at critical allows NotebookEdit", call("PreToolUse", "NotebookEdit", "", ""), 195000, ""},
+		{"pre at critical allows the handoff path", call("PreToolUse", "MultiEdit", handoff, ""), 195000, ""},
+		{"pre at critical allows Bash writing the handoff", call("PreToolUse", "Bash", "", "cat > "+handoff+" <<EOF"), 195000, ""},
+		{"pre at critical denies Bash elsewhere", call("PreToolUse", "Bash", "", "cat > /tmp/other.md"), 195000, "deny"},
+		{"post below warn", call("PostToolUse", "Bash", "", ""), 174999, ""},
+		{"post at warn", call("PostToolUse", "Bash", "", ""), 175000, "warn"},
+		{"post over critical still warns", call("PostToolUse", "Read", "", ""), 191000, "warn"},
+		{"other events", call("Stop", "", "", ""), 195000, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := contextGuard(tt.in, tt.usage, 175000, 190000, handoff)
+			got := ""
+			if out != nil {
+				got = "warn"
+				if out.HookSpecificOutput.PermissionDecision == "deny" {
+					got = "deny"
+				}
+			}
+			if got != tt.want {
+				t.Errorf("contextGuard = %q (%+v), want %q", got, out, tt.want)
+			}
+		})
+	}
+
+	t.Run("output format", func(t *testing.T) {
+		data, _ := json.Marshal(contextGuard(call("PreToolUse", "Bash", "", ""), 195000, 175000, 190000, ""))
+		want := `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"Context 195000 tokens has exceeded the limit of 190000.`
+		if !strings.HasPrefix(string(data), want) {
+			t.Errorf("deny output = %s", data)
+		}
+		data, _ = json.Marshal(contextGuard(call("PostToolUse", "Bash", "", ""), 180000, 175000, 190000, ""))
+		want = `{"hookSpecificOutput":{"hookEventName":"PostToolUse","additionalContext":"WARNING: Context has used 180000 tokens, approximately 10000 tokens remaining`
+		if !strings.HasPrefix(string(data), want) {
+			t.Errorf("warn output = %s", data)
+		}
+	})
+}
+
+func TestRunHook(t *testing.T) {
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := writeTestFile(transcript, assistantLine(100000, 0, 95000, 500)+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CTX_WARN_TOKENS", "175000")
+	t.Setenv("CTX_CRITICAL_TOKENS", "190000")
+	t.Setenv("ICC_HANDOFF_PATH", "")
+	t.Setenv("ICC_HOOK_STATE_DIR", t.TempDir())
+	runDir := t.TempDir()
+	t.Setenv("ICC_RUN_DIR", runDir)
+
+	hook := func(input string) string {
+		t.Helper()
+		stdin, w, _ := os.Pipe()
+		r, stdout, _ := os.Pipe()
+		oldIn, oldOut := os.Stdin, os.Stdout
+		os.Stdin, os.Stdout = stdin, stdout
+		defer func() { os.Stdin, os.Stdout = oldIn, oldOut }()
+		w.WriteString(input)
+		w.Close()
+		runHook()
+		stdout.Close()
+		out, _ := io.ReadAll(r)
+		return string(out)
+	}
+
+	got := hook(`{"hook_event_name":"PreToolUse","tool_name":"Bash","transcript_path":"` + transcript + `","tool_input":{"command":"ls"}}`)
+	if !strings.Contains(got, `"permissionDecision":"deny"`) || !strings.Contains(got, "Context 195500 tokens") {
+		t.Errorf("expected a denial at 195500 tokens, got %q", got)
+	}
+	if got := sessionTranscript(runDir, "", time.Time{}, false); got != transcript {
+		t.Errorf("recorded transcript = %q, want %q", got, transcript)
+	}
+	if got := hook(`{"hook_event_name":"PreToolUse","tool_name":"Bash","transcript_path":"/nonexistent.jsonl"}`); got != "" {
+		t.Errorf("missing transcript: got %q, want no output", got)
+	}
+	if got := hook(`not json`); got != "" {
+		t.Errorf("invalid input: got %q, want no output", got)
+	}
+}
+
+func TestHookStateDir(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("ICC_HOOK_STATE_DIR", "")
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	if dir := hookStateDir(); !strings.HasPrefix(dir, cache) || !strings.HasSuffix(dir, filepath.Join("icc", "hook-state")) {
+		t.Errorf("hookStateDir = %q, want icc/hook-state in the user cache dir", dir)
+	}
+}
+
+func TestPrivateDir(t *testing.T) {
+	root := t.TempDir()
+	private := filepath.Join(root, "private")
+	shared := filepath.Join(root, "shared")
+	os.Mkdir(private, 0700)
+	os.Mkdir(shared, 0700)
+	os.Chmod(shared, 0777)
+	link := filepath.Join(root, "link")
+	os.Symlink(private, link)
+
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{private, true},
+		{filepath.Join(root, "missing"), true},
+		{shared, false},
+		{link, false},
+	}
+	for _, tt := range tests {
+		if got := privateDir(tt.dir); got != tt.want {
+			t.Errorf("privateDir(%s) = %v, want %v", filepath.Base(tt.dir), got, tt.want)
+		}
+	}
+
+	// State in a directory others can write is ignored and not saved.
+	os.Chmod(shared, 0777)
+	t.Setenv("ICC_HOOK_STATE_DIR", shared)
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	line := assistantLine(1000, 0, 0, 100) + "\n"
+	appendTestFile(t, transcript, line)
+	writeTestFile(hookStatePath(transcript), fmt.Sprintf(`{"path":%q,"offset":%d,"usage":5}`, transcript, len(line)))
+	if n, err := transcriptUsage(transcript); err != nil || n != 1100 {
+		t.Errorf("usage = %d, %v; want 1100 from a full scan", n, err)
+	}
+}
+
+func TestPruneHookState(t *testing.T) {
+	dir := t.TempDir()
+	old, fresh, other := filepath.Join(dir, "old.json"), filepath.Join(dir, "fresh.json"), filepath.Join(dir, "notes.txt")
+	for _, path := range []string{old, fresh, other} {
+		writeTestFile(path, "{}")
+	}
+	long := time.Now().Add(-2 * hookStateMaxAge)
+	os.Chtimes(old, long, long)
+	os.Chtimes(other, long, long)
+
+	pruneHookState(dir, time.Now().Add(-hookStateMaxAge))
+	if fileExists(old) || !fileExists(fresh) || !fileExists(other) {
+		t.Errorf("after pruning: old %v, fresh %v, other %v; want only old removed", fileExists(old), fileExists(fresh), fileExists(other))
+	}
+}
+
+func TestTranscriptUsage(t *testing.T) {
+	t.Setenv("ICC_HOOK_STATE_DIR", t.TempDir())
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	appendTestFile(t, transcript, assistantLine(1000, 0, 0, 100)+"\n")
+
+	usage := func() int {
+		t.Helper()
+		n, err := transcriptUsage(transcript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if got := usage(); got != 1100 {
+		t.Fatalf("first call: usage = %d, want 1100", got)
+	}
+
+	// Doctor the saved usage: a later call that only reads the appended
+	// lines keeps it when they hold no usage.
+	state := hookStatePath(transcript)
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	var s usageScanner
+	json.Unmarshal(data, &s)
+	s.Usage = 4242
+	data, _ = json.Marshal(s)
+	writeTestFile(state, string(data))
+
+	appendTestFile(t, transcript, `{"type":"user"}`+"\n")
+	if got := usage(); got != 4242 {
+		t.Errorf("after a user entry: usage = %d, want the saved 4242", got)
+	}
+	appendTestFile(t, transcript, assistantLine(5000, 0, 0, 50)+"\n")
+	if got := usage(); got != 5050 {
+		t.Errorf("after an assistant entry: usage = %d, want 5050", got)
+	}
+
+	t.Run("rewritten transcript is rescanned", func(t *testing.T) {
+		writeTestFile(transcript, assistantLine(10, 0, 0, 30)+"\n")
+		if got := usage(); got != 40 {
+			t.Errorf("usage = %d, want 40", got)
+		}
+	})
+
+	t.Run("state of another transcript is ignored", func(t *testing.T) {
+		other := filepath.Join(t.TempDir(), "other.jsonl")
+		appendTestFile(t, other, assistantLine(7, 0, 0, 30)+"\n")
+		writeTestFile(hookStatePath(other), `{"path":"/elsewhere.jsonl","offset":99999,"usage":1}`)
+		if got, _ := transcriptUsage(other); got != 37 {
+			t.Errorf("usage = %d, want 37", got)
+		}
+	})
+}
+
+// benchmarkTranscript writes a transcript of n entries, alternating user
+// and assistant lines the size of real ones.
+func benchmarkTranscript(b *testing.B, n int) string {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "session.jsonl")
+	user := `{"type":"user","message":{"role":"user","content":"` + strings.Repeat("x", 1500) + `"}}` + "\n"
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			sb.WriteString(user)
+		} else {
+			sb.WriteString(assistantLine(1000+i, 0, 50000, 100) + "\n")
+		}
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// BenchmarkTranscriptUsage measures one hook call after a tool call added
+// two entries. With the saved state the cost does not depend on the
+// transcript length; the full scan it replaces grows with it.
+func BenchmarkTranscriptUsage(b *testing.B) {
+	for _, n := range []int{1000, 5000, 20000} {
+		b.Run(fmt.Sprintf("incremental-%d", n), func(b *testing.B) {
+			b.Setenv("ICC_HOOK_STATE_DIR", b.TempDir())
+			path := benchmarkTranscript(b, n)
+			if _, err := transcriptUsage(path); err != nil {
+				b.Fatal(err)
+			}
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			entries := `{"type":"user"}` + "\n" + assistantLine(2000, 0, 50000, 100) + "\n"
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f.WriteString(entries)
+				if _, err := transcriptUsage(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("full-%d", n), func(b *testing.B) {
+			path := benchmarkTranscript(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s := usageScanner{Path: path}
+				if err := s.scan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestIsContextGuardCommand(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{legacyHookCmd, true},
+		{"/usr/local/bin/icc hook", true},
+		{"'/Users/me/my tools/icc' hook", true},
+		{"icc hook", true},
+		{hookCommand(), true},
+		{"/usr/local/bin/icc install", false},
+		{"/usr/bin/other hook", false},
+		{"icc-notify hook", false},
+		{"/usr/local/bin/icc-notify hook", false},
+		{"'/opt/my tools/iccx' hook", false},
+		{"~/.claude/hooks/other.sh", false},
+	}
+	for _, tt := range tests {
+		if got := isContextGuardCommand(tt.cmd); got != tt.want {
+			t.Errorf("isContextGuardCommand(%q) = %v, want %v", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Idle policies: what to do when claude sits at its input prompt.
+const (
+	idlePolicyNudge  = "nudge"  // send the nudge message, up to maxIdleNudges times
+	idlePolicyReport = "report" // ask for a completion report or a handoff
+	idlePolicyExit   = "exit"   // exit claude and start a recovery session
+)
+
+// maxIdleNudges bounds how often an idle agent is nudged before the session
+// is ended and a recovery session started.
+const maxIdleNudges = 3
+
+// taskCompleteMarker is the reply an agent gives when asked whether the
+// task is complete and it is.
+const taskCompleteMarker = "ICC_TASK_COMPLETE"
+
+// taskCompleteRe matches the marker alone on a line (optionally behind
+// claude's ⏺ bullet), so the request text quoting it does not match.
+var taskCompleteRe = regexp.MustCompile(`(?m)^[\s⏺●]*` + taskCompleteMarker + `\s*$`)
+
+const defaultIdleNudge = `[ICC SUPERVISOR] You stopped and are waiting for input, but no human is watching this session. You are AUTONOMOUS: do not ask questions, make a reasonable decision and continue working on the task.
+If the task is fully complete, reply with a final message whose last line is the word ` + taskCompleteMarker + ` and nothing else.`
+
+// idleConfig controls idle detection in waitForSignal.
+type idleConfig struct {
+	Timeout time.Duration // pane unchanged this long at the ready prompt; 0 disables
+	Policy  string
+	Nudge   string
+}
+
+func validIdlePolicy(p string) bool {
+	return p == idlePolicyNudge || p == idlePolicyReport || p == idlePolicyExit
+}
+
+// idleTracker decides when a pane counts as idle: the ready prompt is
+// visible and the pane content has not changed for the timeout.
+// While claude works its spinner and timer keep the pane changing.
+type idleTracker struct {
+	timeout    time.Duration
+	last       string
+	lastChange time.Time
+}
+
+// reset restarts the idle period, e.g. after a message was sent.
+func (t *idleTracker) reset(now time.Time) {
+	t.lastChange = now
+}
+
+// observe records a pane snapshot taken at now and reports whether the
+// pane is idle.
+func (t *idleTracker) observe(text string, now time.Time) bool {
+	if text != t.last {
+		t.last = text
+		t.lastChange = now
+		return false
+	}
+	return now.Sub(t.lastChange) >= t.timeout && paneShowsReadyPrompt(text)
+}
+
+// idleCheckInterval is how often the pane is captured for idle detection.
+func idleCheckInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 6
+	if interval > 10*time.Second {
+		interval = 10 * time.Second
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// paneShowsReadyPrompt reports whether claude's ❯ input prompt is visible
+// near the bottom of the pane text and claude is not working. The input
+// box shows ❯ while claude works too, with "esc to interrupt" above it.
+func paneShowsReadyPrompt(text string) bool {
+	if strings.Contains(strings.ToLower(lastLines(text, conditionLines)), "esc to interrupt") {
+		return false
+	}
+	lines := splitLines(strings.TrimRight(text, "\n"))
+	if len(lines) > 6 {
+		lines = lines[len(lines)-6:]
+	}
+	return strings.Contains(strings.Join(lines, "\n"), "❯")
+}
+
+// completionReportRequest asks an idle agent to either declare the task
+// complete or write a handoff.
+func completionReportRequest(handoffPath string) string {
+	return fmt.Sprintf(`[ICC SUPERVISOR] You have been idle at the prompt. No human is watching this session.
+- If the task is fully complete, reply with a short completion report whose last line is the word %s and nothing else.
+- Otherwise, write the handoff file to %s now (format in the system instructions) so the next session can continue.`,
+		taskCompleteMarker, handoffPath)
+}
+
+// idleRecoveryNote stands in for a handoff when a session was ended for
+// idling without writing one.
+func idleRecoveryNote(session int) string {
+	return fmt.Sprintf(`(No handoff was written. Session %d stopped at its input prompt and did not resume when prompted, so the supervisor ended it.
+Reorient from the repository state above, verify what was finished, and continue the task.)`, session)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTracker(t *testing.T) {
+	const ready = "⏺ Done.\n╭──────╮\n│ ❯    │\n╰──────╯"
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("idle after timeout with unchanged ready pane", func(t *testing.T) {
+		tr := idleTracker{timeout: time.Minute}
+		tr.reset(start)
+		if tr.observe(ready, start.Add(10*time.Second)) {
+			t.Error("first snapshot should never be idle")
+		}
+		if tr.observe(ready, start.Add(40*time.Second)) {
+			t.Error("idle before timeout elapsed")
+		}
+		if !tr.observe(ready, start.Add(71*time.Second)) {
+			t.Error("expected idle after timeout")
+		}
+	})
+
+	t.Run("pane change restarts the period", func(t *testing.T) {
+		tr := idleTracker{timeout: time.Minute}
+		tr.observe(ready, start)
+		tr.observe("✻ Thinking… (3s)\n"+ready, start.Add(50*time.Second))
+		if tr.observe("✻ Thinking… (3s)\n"+ready, start.Add(70*time.Second)) {
+			t.Error("idle period should restart when the pane changes")
+		}
+	})
+
+	t.Run("not idle without the ready prompt", func(t *testing.T) {
+		tr := idleTracker{timeout: time.Minute}
+		tr.observe("Select login method:", start)
+		if tr.observe("Select login method:", start.Add(2*time.Minute)) {
+			t.Error("pane without ❯ should not count as idle")
+		}
+	})
+
+	t.Run("not idle while claude is working", func(t *testing.T) {
+		busy := "✻ Compiling… (4m 12s · esc to interrupt)\n" + ready
+		tr := idleTracker{timeout: time.Minute}
+		tr.observe(busy, start)
+		if tr.observe(busy, start.Add(2*time.Minute)) {
+			t.Error("pane with the busy indicator should not count as idle")
+		}
+	})
+
+	t.Run("reset restarts the period", func(t *testing.T) {
+		tr := idleTracker{timeout: time.Minute}
+		tr.observe(ready, start)
+		tr.reset(start.Add(2 * time.Minute))
+		if tr.observe(ready, start.Add(2*time.Minute+time.Second)) {
+			t.Error("expected not idle right after reset")
+		}
+	})
+}
+
+func TestTaskCompleteRe(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{"bare marker line", "All tests pass.\nICC_TASK_COMPLETE\n", true},
+		{"marker behind bullet", "⏺ Summary done.\n\n  ICC_TASK_COMPLETE", true},
+		{"quoted in request", "> - If the task is fully complete, reply with a short completion report whose last line is the word ICC_TASK_COMPLETE and nothing else.", false},
+		{"default nudge", defaultIdleNudge, false},
+		{"report request", completionReportRequest("/tmp/icc-handoff-x.md"), false},
+		{"absent", "⏺ Working on it", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := taskCompleteRe.MatchString(tt.in); got != tt.want {
+				t.Errorf("taskCompleteRe.MatchString(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdleCheckInterval(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{3 * time.Second, time.Second},
+		{30 * time.Second, 5 * time.Second},
+		{5 * time.Minute, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := idleCheckInterval(tt.timeout); got != tt.want {
+			t.Errorf("idleCheckInterval(%s) = %s, want %s", tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestValidIdlePolicy(t *testing.T) {
+	for _, p := range []string{"nudge", "report", "exit"} {
+		if !validIdlePolicy(p) {
+			t.Errorf("expected %q to be valid", p)
+		}
+	}
+	if validIdlePolicy("ignore") {
+		t.Error("expected unknown policy to be invalid")
+	}
+}
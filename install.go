@@ -1,49 +1,167 @@
 package main
 
 import (
-	_ "embed"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-//go:embed context-guard.sh
-var contextGuardSh []byte
+// legacyHookCmd is the context-guard.sh hook that earlier versions
+// installed. 'icc install' replaces it with 'icc hook'.
+const legacyHookCmd = "~/.claude/hooks/context-guard.sh"
 
-const hookCmd = "~/.claude/hooks/context-guard.sh"
+// Settings scopes 'icc install' can write to.
+const (
+	scopeUser    = "user"    // ~/.claude/settings.json
+	scopeProject = "project" // <repo>/.claude/settings.json, meant to be committed
+	scopeLocal   = "local"   // <repo>/.claude/settings.local.json
+)
+
+var installScopes = []string{scopeUser, scopeProject, scopeLocal}
+
+// scopeSettingsPath returns the settings file of a scope. The project and
+// local scopes belong to the git repository containing the current
+// directory, or to the directory itself outside git.
+func scopeSettingsPath(scope string) (string, error) {
+	return scopeSettingsPathIn(scope, "")
+}
 
-func runInstall() {
-	home, err := os.UserHomeDir()
+// scopeSettingsPathIn is scopeSettingsPath for claude sessions in dir
+// rather than the current directory.
+func scopeSettingsPathIn(scope, dir string) (string, error) {
+	if scope == scopeUser {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine home directory: %w", err)
+		}
+		return filepath.Join(home, ".claude", "settings.json"), nil
+	}
+	if dir == "" {
+		var err error
+		if dir, err = os.Getwd(); err != nil {
+			return "", err
+		}
+	}
+	root := runGit("-C", dir, "rev-parse", "--show-toplevel")
+	if root == "" {
+		root = dir
+	}
+	switch scope {
+	case scopeProject:
+		return filepath.Join(root, ".claude", "settings.json"), nil
+	case scopeLocal:
+		return filepath.Join(root, ".claude", "settings.local.json"), nil
+	}
+	return "", fmt.Errorf("invalid scope %q (want user, project or local)", scope)
+}
+
+// hookCommand is the hook command 'icc install' registers: this binary,
+// by absolute path, with the hook subcommand.
+func hookCommand() string {
+	exe, err := os.Executable()
 	if err != nil {
-		errMsg("Cannot determine home directory: %v", err)
-		os.Exit(1)
+		exe = "icc"
 	}
+	if strings.ContainsAny(exe, " '\"\\$") {
+		exe = "'" + strings.ReplaceAll(exe, "'", `'\''`) + "'"
+	}
+	return exe + " hook"
+}
 
-	hookDir := filepath.Join(home, ".claude", "hooks")
-	hookDst := filepath.Join(hookDir, "context-guard.sh")
-	settingsPath := filepath.Join(home, ".claude", "settings.json")
+// scopeHookCommand is the hook command for a scope. Project settings are
+// shared through the repository, where an absolute path to one
+// developer's binary would be wrong, so they run icc from PATH.
+func scopeHookCommand(scope string) string {
+	if scope == scopeProject {
+		return "icc hook"
+	}
+	return hookCommand()
+}
 
-	// 1. Install hook script
-	os.MkdirAll(hookDir, 0755)
+// isContextGuardCommand reports whether a hook command is the context
+// guard: the legacy script, the command this binary registers, or the hook
+// subcommand of a binary named exactly icc. Other tools' hook commands,
+// such as "icc-notify hook", are left alone.
+func isContextGuardCommand(cmd string) bool {
+	if cmd == legacyHookCmd || cmd == hookCommand() {
+		return true
+	}
+	exe, ok := strings.CutSuffix(cmd, " hook")
+	if !ok {
+		return false
+	}
+	return filepath.Base(strings.Trim(exe, "'")) == "icc"
+}
 
-	existing, err := os.ReadFile(hookDst)
-	if err == nil && string(existing) == string(contextGuardSh) {
-		okMsg("Hook script is up to date: %s", hookDst)
-	} else {
-		if err := os.WriteFile(hookDst, contextGuardSh, 0755); err != nil {
-			errMsg("Failed to write hook script: %v", err)
+// runInstall implements 'icc install [--scope user|project|local]
+// [--dry-run]' and 'icc install --status'.
+func runInstall(args []string) {
+	scope := scopeUser
+	dryRun := false
+	for i := 0; i < len(args); {
+		switch args[i] {
+		case "--scope":
+			scope = requireArg(args, i, "--scope")
+			i += 2
+		case "--dry-run":
+			dryRun = true
+			i++
+		case "--status":
+			printInstallStatus()
+			return
+		default:
+			fmt.Fprintln(os.Stderr, "Usage: icc install [--scope user|project|local] [--dry-run] | icc install --status")
 			os.Exit(1)
 		}
-		okMsg("Hook script installed: %s", hookDst)
+	}
+	settingsPath, err := scopeSettingsPath(scope)
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
 	}
 
-	// 2. Register hooks in settings.json
-	registerHooks(settingsPath)
+	cmd := scopeHookCommand(scope)
+	before, after, err := registerHooks(settingsPath, cmd)
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
+	}
+	switch {
+	case before == after:
+		okMsg("Hooks already registered, no update needed")
+	case dryRun:
+		fmt.Print(unifiedDiff(settingsPath, settingsPath+" (after install)", before, after))
+	default:
+		backup, err := writeSettings(settingsPath, before, after)
+		if err != nil {
+			errMsg("%v", err)
+			os.Exit(1)
+		}
+		if backup != "" {
+			okMsg("Hooks registered in %s (backup: %s)", settingsPath, backup)
+		} else {
+			okMsg("Hooks registered in %s", settingsPath)
+		}
+	}
+	if dryRun {
+		return
+	}
 
 	fmt.Printf("\n%s%sInstallation complete!%s\n", colorGreen, colorBold, colorReset)
-	fmt.Printf("  Hook script: %s\n", hookDst)
-	fmt.Printf("  Settings: %s\n", settingsPath)
+	fmt.Printf("  Hook command: %s\n", cmd)
+	fmt.Printf("  Settings: %s (%s scope)\n", settingsPath, scope)
+	if scope == scopeProject {
+		fmt.Printf("  Commit this file to share the hook; everyone using it needs icc in PATH.\n")
+	}
+	if home, err := os.UserHomeDir(); err == nil && fileExists(filepath.Join(home, ".claude", "hooks", "context-guard.sh")) {
+		fmt.Printf("  The old hook script ~/.claude/hooks/context-guard.sh is no longer used and can be deleted.\n")
+	}
 	fmt.Printf("\n%sConfiguration:%s\n", colorYellow, colorReset)
 	fmt.Printf("  CTX_WARN_TOKENS=175000     # Warning threshold (override via env var)\n")
 	fmt.Printf("  CTX_CRITICAL_TOKENS=190000 # Rejection threshold (override via env var)\n")
@@ -51,68 +169,272 @@ func runInstall() {
 	fmt.Printf("  ICC_HANDOFF_PATH           # Set automatically by icc; agent writes handoff to this path\n")
 }
 
-func registerHooks(settingsPath string) {
-	hookEntry := []interface{}{
-		map[string]interface{}{
-			"hooks": []interface{}{
-				map[string]interface{}{
-					"type":    "command",
-					"command": hookCmd,
-					"timeout": 10,
-				},
-			},
-		},
+// hookStatus describes the context guard registered in one settings file.
+type hookStatus struct {
+	Path     string
+	Events   []string // events the guard is registered for
+	Commands []string // its distinct commands
+}
+
+// readHookStatus finds the context guard in a settings file. A missing or
+// unparsable file has none.
+func readHookStatus(path string) hookStatus {
+	st := hookStatus{Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st
+	}
+	var settings map[string]interface{}
+	if json.Unmarshal(data, &settings) != nil {
+		return st
+	}
+	hooks, _ := settings["hooks"].(map[string]interface{})
+	for _, event := range []string{"PreToolUse", "PostToolUse"} {
+		found := false
+		for _, h := range eventHooks(hooks[event]) {
+			c, _ := h["command"].(string)
+			if !isContextGuardCommand(c) {
+				continue
+			}
+			found = true
+			if !containsString(st.Commands, c) {
+				st.Commands = append(st.Commands, c)
+			}
+		}
+		if found {
+			st.Events = append(st.Events, event)
+		}
+	}
+	return st
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
+	return false
+}
 
-	settings := map[string]interface{}{}
+// foreignHookBinary ends the hookCommandVersion of a binary that is
+// neither this icc nor the icc in PATH.
+const foreignHookBinary = "unknown binary, not run"
 
-	data, err := os.ReadFile(settingsPath)
-	if err == nil {
-		if err := json.Unmarshal(data, &settings); err != nil {
-			errMsg("Failed to parse %s: %v", settingsPath, err)
-			os.Exit(1)
+// hookCommandVersion reports what a registered hook command runs: the
+// legacy script, or an icc binary and its --version. Settings files can
+// come with an untrusted repository, so only this binary and the icc in
+// PATH are asked for their version; any other path is reported as
+// foreignHookBinary without being run.
+func hookCommandVersion(cmd string) string {
+	if cmd == legacyHookCmd {
+		return "legacy context-guard.sh, reinstall to switch to icc hook"
+	}
+	exe := strings.Trim(strings.TrimSuffix(cmd, " hook"), "'")
+	if !strings.Contains(exe, "/") {
+		p, err := exec.LookPath(exe)
+		if err != nil {
+			return exe + " not found in PATH"
 		}
+		exe = p
+	}
+	real, err := filepath.EvalSymlinks(exe)
+	if err != nil {
+		return exe + " not found"
+	}
+	if self, err := os.Executable(); err == nil && sameFile(real, self) {
+		return "icc " + version
+	}
+	inPath, err := exec.LookPath("icc")
+	if err != nil || !sameFile(real, inPath) {
+		return exe + ": " + foreignHookBinary
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, real, "--version").Output()
+	if err != nil {
+		return "cannot run " + exe
+	}
+	return "icc " + strings.TrimSpace(string(out))
+}
 
-	hooks, _ := settings["hooks"].(map[string]interface{})
-	if hooks == nil {
-		hooks = map[string]interface{}{}
+// sameFile reports whether two paths name the same file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
 	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
 
-	updated := false
-	for _, event := range []string{"PreToolUse", "PostToolUse"} {
-		if !hasHookCommand(hooks[event], hookCmd) {
-			existing, _ := hooks[event].([]interface{})
-			hooks[event] = append(existing, hookEntry[0])
-			updated = true
+// printInstallStatus implements 'icc install --status'.
+func printInstallStatus() {
+	fmt.Printf("Context-guard hook (this binary: icc %s):\n", version)
+	for _, scope := range installScopes {
+		path, err := scopeSettingsPath(scope)
+		if err != nil {
+			fmt.Printf("  %-8s %v\n", scope, err)
+			continue
+		}
+		st := readHookStatus(path)
+		switch {
+		case len(st.Commands) == 0:
+			fmt.Printf("  %-8s %s: not installed\n", scope, path)
+			continue
+		case len(st.Events) == 1:
+			fmt.Printf("  %-8s %s: %s only, reinstall to add the other event\n", scope, path, st.Events[0])
+		default:
+			fmt.Printf("  %-8s %s: installed\n", scope, path)
+		}
+		for _, c := range st.Commands {
+			fmt.Printf("           %s (%s)\n", c, hookCommandVersion(c))
 		}
 	}
+}
 
-	if !updated {
-		okMsg("Hooks already registered, no update needed")
-		return
+// registerHooks computes settingsPath with the context guard cmd
+// registered for PreToolUse and PostToolUse: it returns the current and
+// the new content. Context guards registered earlier (the legacy script,
+// or an icc binary at another path) are switched to cmd. The rest of the
+// file is left as it is written.
+func registerHooks(settingsPath, cmd string) (before, after string, err error) {
+	data, err := os.ReadFile(settingsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	text := string(data)
+	if os.IsNotExist(err) {
+		text = "{}\n"
+	}
+	doc, err := parseJSONDoc(text)
+	if err == nil && doc.root.Kind != '{' {
+		err = fmt.Errorf("not a JSON object")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse %s: %w", settingsPath, err)
 	}
 
-	settings["hooks"] = hooks
+	entry := settingsHookEntry{Hooks: []settingsHook{{Type: "command", Command: cmd, Timeout: 10}}}
+	for _, event := range []string{"PreToolUse", "PostToolUse"} {
+		// Switch older guards over, then add one if there is none.
+		var stale [][]interface{}
+		found := false
+		for i, e := range doc.at("hooks", event).elems() {
+			for j, h := range e.member("hooks").elems() {
+				c := doc.str(h.member("command"))
+				found = found || isContextGuardCommand(c)
+				if c != cmd && isContextGuardCommand(c) {
+					stale = append(stale, []interface{}{"hooks", event, i, "hooks", j, "command"})
+				}
+			}
+		}
+		for _, path := range stale {
+			if err := doc.replace(doc.at(path...), cmd); err != nil {
+				return "", "", err
+			}
+		}
+		if found {
+			continue
+		}
+
+		hooks, entries := doc.at("hooks"), doc.at("hooks", event)
+		switch {
+		case hooks == nil:
+			err = doc.addMember(doc.root, "hooks", map[string][]settingsHookEntry{event: {entry}})
+		case hooks.Kind != '{':
+			err = doc.replace(hooks, map[string][]settingsHookEntry{event: {entry}})
+		case entries == nil:
+			err = doc.addMember(hooks, event, []settingsHookEntry{entry})
+		case entries.Kind != '[':
+			err = doc.replace(entries, []settingsHookEntry{entry})
+		default:
+			err = doc.appendElem(entries, entry)
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return string(data), doc.text, nil
+}
 
-	out, err := json.MarshalIndent(settings, "", "  ")
+// writeSettings replaces the settings file at path, read as before, with
+// after. It refuses if the file no longer holds before, so an edit made in
+// the meantime (by claude, or an editor) is never lost. An existing file
+// is backed up to <path>.bak-<time> first, without replacing an earlier
+// backup. The new content goes to a temporary file renamed over path, so
+// a crash leaves the old file or the new one, never half of one. A
+// symlinked path is written through the link. It returns the backup's
+// path, "" for a new file.
+func writeSettings(path, before, after string) (backup string, err error) {
+	target, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		target = path
+	} else if err != nil {
+		return "", err
+	}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(target); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := checkSettingsUnchanged(path, target, before); err != nil {
+		return "", err
+	}
+	if fileExists(target) {
+		stamp := time.Now().Format("20060102-150405")
+		backup = path + ".bak-" + stamp
+		for n := 2; fileExists(backup); n++ {
+			backup = fmt.Sprintf("%s.bak-%s-%d", path, stamp, n)
+		}
+		if err := os.WriteFile(backup, []byte(before), mode); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-")
 	if err != nil {
-		errMsg("Failed to marshal settings: %v", err)
-		os.Exit(1)
+		return "", err
 	}
-	if err := os.WriteFile(settingsPath, append(out, '\n'), 0644); err != nil {
-		errMsg("Failed to write %s: %v", settingsPath, err)
-		os.Exit(1)
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(after)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err := errors.Join(err, tmp.Chmod(mode), tmp.Close()); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := checkSettingsUnchanged(path, target, before); err != nil {
+		return "", err
 	}
-	okMsg("Hooks registered in settings.json")
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return backup, nil
 }
 
-// hasHookCommand checks if the event's hook array already contains our command.
-func hasHookCommand(eventVal interface{}, cmd string) bool {
+// checkSettingsUnchanged returns an error if target, the file path
+// resolves to, no longer holds before ("" for no file).
+func checkSettingsUnchanged(path, target, before string) error {
+	data, err := os.ReadFile(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if string(data) != before || os.IsNotExist(err) && before != "" {
+		return fmt.Errorf("%s changed while icc was editing it; nothing was written, run the command again", path)
+	}
+	return nil
+}
+
+// eventHooks returns the hook objects of an event's hook array.
+func eventHooks(eventVal interface{}) []map[string]interface{} {
 	entries, ok := eventVal.([]interface{})
 	if !ok {
-		return false
+		return nil
 	}
+	var out []map[string]interface{}
 	for _, entry := range entries {
 		e, ok := entry.(map[string]interface{})
 		if !ok {
@@ -123,14 +445,248 @@ func hasHookCommand(eventVal interface{}, cmd string) bool {
 			continue
 		}
 		for _, h := range innerHooks {
-			hm, ok := h.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			if hm["command"] == cmd {
-				return true
+			if hm, ok := h.(map[string]interface{}); ok {
+				out = append(out, hm)
 			}
 		}
 	}
+	return out
+}
+
+// hasHookCommand checks if the event's hook array already contains cmd.
+func hasHookCommand(eventVal interface{}, cmd string) bool {
+	for _, h := range eventHooks(eventVal) {
+		if h["command"] == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// hasContextGuard checks if the event's hook array contains a context guard.
+func hasContextGuard(eventVal interface{}) bool {
+	for _, h := range eventHooks(eventVal) {
+		if c, _ := h["command"].(string); isContextGuardCommand(c) {
+			return true
+		}
+	}
 	return false
 }
+
+// forEachGuardCommand calls fn for every context-guard command registered
+// for PreToolUse or PostToolUse in the settings claude reads for sessions
+// in workdir: the user's, and the project and local settings at the top of
+// workdir's repository.
+func forEachGuardCommand(workdir string, fn func(scope, event, cmd string)) {
+	for _, scope := range installScopes {
+		p, err := scopeSettingsPathIn(scope, workdir)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var settings map[string]interface{}
+		if json.Unmarshal(data, &settings) != nil {
+			continue
+		}
+		hooks, _ := settings["hooks"].(map[string]interface{})
+		for _, event := range []string{"PreToolUse", "PostToolUse"} {
+			for _, h := range eventHooks(hooks[event]) {
+				if c, _ := h["command"].(string); isContextGuardCommand(c) {
+					fn(scope, event, c)
+				}
+			}
+		}
+	}
+}
+
+// hookActive reports whether icc hook is registered for both events in
+// the settings claude reads for sessions in workdir. The legacy script
+// does not count, so a run still gets the hook through its own settings;
+// see warnLegacyHook.
+func hookActive(workdir string) bool {
+	registered := map[string]bool{}
+	forEachGuardCommand(workdir, func(_, event, cmd string) {
+		if cmd != legacyHookCmd {
+			registered[event] = true
+		}
+	})
+	return registered["PreToolUse"] && registered["PostToolUse"]
+}
+
+// legacyHookScopes returns the scopes whose settings still register the
+// legacy context-guard.sh for sessions in workdir.
+func legacyHookScopes(workdir string) []string {
+	var scopes []string
+	forEachGuardCommand(workdir, func(scope, _, cmd string) {
+		if cmd == legacyHookCmd && !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	})
+	return scopes
+}
+
+// warnLegacyHook warns that a still registered legacy context-guard.sh
+// repeats every warning of the run's own guard, and how to migrate.
+func warnLegacyHook(workdir string) {
+	for _, scope := range legacyHookScopes(workdir) {
+		install := "icc install"
+		if scope != scopeUser {
+			install += " --scope " + scope
+		}
+		errMsg("The %s settings still register the old context-guard.sh, so every context warning comes twice. Run '%s' to switch it to icc hook", scope, install)
+	}
+}
+
+// runUninstall implements 'icc uninstall [--scope S] [--dry-run]': it
+// removes the context guard from the scope's settings file, after backing
+// the file up, and for the user scope deletes the legacy hook script.
+func runUninstall(args []string) {
+	dryRun := false
+	scope := scopeUser
+	for i := 0; i < len(args); {
+		switch args[i] {
+		case "--dry-run":
+			dryRun = true
+			i++
+		case "--scope":
+			scope = requireArg(args, i, "--scope")
+			i += 2
+		default:
+			fmt.Fprintln(os.Stderr, "Usage: icc uninstall [--scope user|project|local] [--dry-run]")
+			os.Exit(1)
+		}
+	}
+
+	settingsPath, err := scopeSettingsPath(scope)
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
+	}
+	script := ""
+	if scope == scopeUser {
+		script = filepath.Join(filepath.Dir(settingsPath), "hooks", "context-guard.sh")
+	}
+
+	before, after, removed, err := unregisterHooks(settingsPath)
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
+	}
+	hasScript := script != "" && fileExists(script)
+
+	if dryRun {
+		if removed == 0 {
+			okMsg("No hooks registered in %s", settingsPath)
+		} else {
+			fmt.Print(unifiedDiff(settingsPath, settingsPath+" (after uninstall)", before, after))
+		}
+		if hasScript {
+			fmt.Printf("Would delete %s\n", script)
+		}
+		return
+	}
+
+	if removed == 0 {
+		okMsg("No hooks registered in %s", settingsPath)
+	} else {
+		backup, err := writeSettings(settingsPath, before, after)
+		if err != nil {
+			errMsg("%v", err)
+			os.Exit(1)
+		}
+		okMsg("Removed %d hook(s) from %s (backup: %s)", removed, settingsPath, backup)
+	}
+	if hasScript {
+		if err := os.Remove(script); err != nil {
+			errMsg("Failed to delete %s: %v", script, err)
+			os.Exit(1)
+		}
+		okMsg("Deleted %s", script)
+	}
+}
+
+// unregisterHooks computes settingsPath without the context guard: it
+// returns the current and the new content and the number of hooks
+// removed. Entries and event arrays left empty are removed too, and the
+// rest of the file is left as it is written. A missing file has nothing
+// to remove.
+func unregisterHooks(settingsPath string) (before, after string, removed int, err error) {
+	data, err := os.ReadFile(settingsPath)
+	if os.IsNotExist(err) {
+		return "", "", 0, nil
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	doc, err := parseJSONDoc(string(data))
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to parse %s: %w", settingsPath, err)
+	}
+
+	var emptied []int // events left without entries, by member index
+	hooks := doc.at("hooks")
+	for k := 0; hooks != nil && k < len(hooks.Members); k++ {
+		event := hooks.Members[k].Key
+		if hooks.Members[k].Value.Kind != '[' {
+			continue
+		}
+		n, err := removeContextGuard(doc, "hooks", event)
+		if err != nil {
+			return "", "", 0, err
+		}
+		removed += n
+		hooks = doc.at("hooks")
+		if n > 0 && len(hooks.Members[k].Value.Elems) == 0 {
+			emptied = append(emptied, k)
+		}
+	}
+	if removed == 0 {
+		return string(data), string(data), 0, nil
+	}
+	if len(emptied) == len(hooks.Members) {
+		err = doc.remove(doc.root, doc.root.memberIndex("hooks"))
+	} else {
+		err = doc.remove(hooks, emptied...)
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	return string(data), doc.text, removed, nil
+}
+
+// removeContextGuard drops the context-guard hooks from the event's hook
+// array at path, and the entries they leave without hooks. It returns the
+// number of hooks removed.
+func removeContextGuard(doc *jsonDoc, path ...interface{}) (int, error) {
+	removed := 0
+	var emptied []int // entries left without hooks
+	for i, e := range doc.at(path...).elems() {
+		inner := e.member("hooks").elems()
+		var guards []int
+		for j, h := range inner {
+			if isContextGuardCommand(doc.str(h.member("command"))) {
+				guards = append(guards, j)
+			}
+		}
+		removed += len(guards)
+		switch {
+		case len(guards) == 0:
+		case len(guards) == len(inner):
+			emptied = append(emptied, i)
+		default:
+			// Removing hooks inside entry i leaves the entries' indexes as
+			// they are.
+			innerPath := append(append([]interface{}{}, path...), i, "hooks")
+			if err := doc.remove(doc.at(innerPath...), guards...); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if len(emptied) == 0 {
+		return removed, nil
+	}
+	return removed, doc.remove(doc.at(path...), emptied...)
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -81,12 +83,26 @@ func TestHasHookCommand(t *testing.T) {
 	})
 }
 
+// installTestHooks registers hookCommand in path the way icc install does.
+func installTestHooks(t *testing.T, path string) {
+	t.Helper()
+	before, after, err := registerHooks(path, hookCommand())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		if _, err := writeSettings(path, before, after); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestRegisterHooks(t *testing.T) {
 	t.Run("creates settings from scratch", func(t *testing.T) {
 		dir := t.TempDir()
 		path := filepath.Join(dir, "settings.json")
 
-		registerHooks(path)
+		installTestHooks(t, path)
 
 		data, err := os.ReadFile(path)
 		if err != nil {
@@ -104,7 +120,7 @@ func TestRegisterHooks(t *testing.T) {
 		}
 
 		for _, event := range []string{"PreToolUse", "PostToolUse"} {
-			if !hasHookCommand(hooks[event], hookCmd) {
+			if !hasHookCommand(hooks[event], hookCommand()) {
 				t.Errorf("hook not registered for %s", event)
 			}
 		}
@@ -120,7 +136,7 @@ func TestRegisterHooks(t *testing.T) {
 		data, _ := json.Marshal(existing)
 		os.WriteFile(path, data, 0644)
 
-		registerHooks(path)
+		installTestHooks(t, path)
 
 		result, _ := os.ReadFile(path)
 		var settings map[string]interface{}
@@ -135,8 +151,8 @@ func TestRegisterHooks(t *testing.T) {
 		dir := t.TempDir()
 		path := filepath.Join(dir, "settings.json")
 
-		registerHooks(path)
-		registerHooks(path)
+		installTestHooks(t, path)
+		installTestHooks(t, path)
 
 		data, _ := os.ReadFile(path)
 		var settings map[string]interface{}
@@ -150,3 +166,428 @@ func TestRegisterHooks(t *testing.T) {
 		}
 	})
 }
+
+func TestRegisterHooksUpgradesLegacyScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	legacy := `{"hooks":{"PreToolUse":[{"hooks":[{"type":"command","command":"` + legacyHookCmd + `","timeout":10}]}]}}`
+	if err := writeTestFile(path, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	installTestHooks(t, path)
+
+	data, _ := os.ReadFile(path)
+	var settings map[string]interface{}
+	json.Unmarshal(data, &settings)
+	hooks := settings["hooks"].(map[string]interface{})
+	for _, event := range []string{"PreToolUse", "PostToolUse"} {
+		if !hasHookCommand(hooks[event], hookCommand()) {
+			t.Errorf("%s: icc hook not registered", event)
+		}
+		if hasHookCommand(hooks[event], legacyHookCmd) {
+			t.Errorf("%s: legacy script still registered", event)
+		}
+		if n := len(hooks[event].([]interface{})); n != 1 {
+			t.Errorf("%s: %d entries, want 1", event, n)
+		}
+	}
+}
+
+func TestHookActive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	workdir := t.TempDir()
+
+	if hookActive(workdir) {
+		t.Error("expected inactive without any settings")
+	}
+
+	t.Run("user settings", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(home, ".claude"), 0755)
+		installTestHooks(t, filepath.Join(home, ".claude", "settings.json"))
+		if !hookActive(workdir) {
+			t.Error("expected active with user settings")
+		}
+		os.Remove(filepath.Join(home, ".claude", "settings.json"))
+	})
+
+	t.Run("legacy script", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(home, ".claude"), 0755)
+		legacy := `{"hooks":{"PreToolUse":[{"hooks":[{"command":"` + legacyHookCmd + `"}]}],"PostToolUse":[{"hooks":[{"command":"` + legacyHookCmd + `"}]}]}}`
+		writeTestFile(filepath.Join(home, ".claude", "settings.json"), legacy)
+		if hookActive(workdir) {
+			t.Error("expected inactive with only the legacy script registered")
+		}
+		if got := legacyHookScopes(workdir); len(got) != 1 || got[0] != scopeUser {
+			t.Errorf("legacyHookScopes = %v, want [user]", got)
+		}
+		os.Remove(filepath.Join(home, ".claude", "settings.json"))
+	})
+
+	t.Run("project local settings", func(t *testing.T) {
+		os.MkdirAll(filepath.Join(workdir, ".claude"), 0755)
+		installTestHooks(t, filepath.Join(workdir, ".claude", "settings.local.json"))
+		if !hookActive(workdir) {
+			t.Error("expected active with project local settings")
+		}
+	})
+
+	t.Run("subdirectory of a repository", func(t *testing.T) {
+		repo := t.TempDir()
+		gitCmd := exec.Command("git", "init", "-q", repo)
+		if out, err := gitCmd.CombinedOutput(); err != nil {
+			t.Skipf("git init: %v\n%s", err, out)
+		}
+		sub := filepath.Join(repo, "pkg", "api")
+		os.MkdirAll(sub, 0755)
+		os.MkdirAll(filepath.Join(repo, ".claude"), 0755)
+		if hookActive(sub) {
+			t.Error("expected inactive before the hook is installed")
+		}
+		installTestHooks(t, filepath.Join(repo, ".claude", "settings.json"))
+		if !hookActive(sub) {
+			t.Error("expected active with project settings at the repository top")
+		}
+	})
+}
+
+func TestUnregisterHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, _, n, err := unregisterHooks(path); n != 0 || err != nil {
+			t.Errorf("got (%d, %v), want nothing to remove", n, err)
+		}
+	})
+
+	t.Run("removes only the context guard", func(t *testing.T) {
+		writeTestFile(path, `{
+  "model": "opus",
+  "hooks": {
+    "PreToolUse": [
+      {"hooks": [{"type": "command", "command": "/usr/local/bin/icc hook"}]},
+      {"matcher": "Bash", "hooks": [{"type": "command", "command": "lint.sh"}, {"type": "command", "command": "`+legacyHookCmd+`"}]}
+    ],
+    "PostToolUse": [
+      {"hooks": [{"type": "command", "command": "/usr/local/bin/icc hook"}]}
+    ],
+    "Stop": [
+      {"hooks": [{"type": "command", "command": "notify.sh"}]}
+    ]
+  }
+}`)
+		before, after, n, err := unregisterHooks(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 {
+			t.Errorf("removed %d hooks, want 3", n)
+		}
+		if data, _ := os.ReadFile(path); string(data) != before {
+			t.Error("unregisterHooks wrote the file")
+		}
+		var settings map[string]interface{}
+		if err := json.Unmarshal([]byte(after), &settings); err != nil {
+			t.Fatal(err)
+		}
+		if settings["model"] != "opus" {
+			t.Error("other settings were not preserved")
+		}
+		hooks := settings["hooks"].(map[string]interface{})
+		if _, ok := hooks["PostToolUse"]; ok {
+			t.Error("empty PostToolUse array was kept")
+		}
+		pre := hooks["PreToolUse"].([]interface{})
+		if len(pre) != 1 || !hasHookCommand(pre, "lint.sh") || hasContextGuard(pre) {
+			t.Errorf("PreToolUse = %v, want only the lint.sh entry", pre)
+		}
+		if !hasHookCommand(hooks["Stop"], "notify.sh") {
+			t.Error("Stop hook was removed")
+		}
+	})
+
+	t.Run("drops an empty hooks object", func(t *testing.T) {
+		writeTestFile(path, `{"hooks":{"PreToolUse":[{"hooks":[{"command":"icc hook"}]}]}}`)
+		_, after, n, err := unregisterHooks(path)
+		if err != nil || n != 1 || after != "{}" {
+			t.Errorf("got (%q, %d, %v), want {} with 1 removed", after, n, err)
+		}
+	})
+}
+
+func TestRunUninstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	claudeDir := filepath.Join(home, ".claude")
+	os.MkdirAll(filepath.Join(claudeDir, "hooks"), 0755)
+	settingsPath := filepath.Join(claudeDir, "settings.json")
+	script := filepath.Join(claudeDir, "hooks", "context-guard.sh")
+	installTestHooks(t, settingsPath)
+	writeTestFile(script, "#!/bin/bash\n")
+	installed, _ := os.ReadFile(settingsPath)
+
+	runUninstall([]string{"--dry-run"})
+	if data, _ := os.ReadFile(settingsPath); string(data) != string(installed) || !fileExists(script) {
+		t.Fatal("--dry-run changed files")
+	}
+
+	runUninstall(nil)
+	data, _ := os.ReadFile(settingsPath)
+	if strings.Contains(string(data), "hook") {
+		t.Errorf("hooks left after uninstall:\n%s", data)
+	}
+	if fileExists(script) {
+		t.Error("legacy script not deleted")
+	}
+	backups, _ := filepath.Glob(settingsPath + ".bak-*")
+	if len(backups) != 1 {
+		t.Fatalf("found %d backups, want 1", len(backups))
+	}
+	if backup, _ := os.ReadFile(backups[0]); string(backup) != string(installed) {
+		t.Error("backup does not hold the installed settings")
+	}
+}
+
+func TestScopeSettingsPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repo := initTestRepo(t)
+	root := strings.TrimSpace(gitTest(t, "rev-parse", "--show-toplevel"))
+	os.Mkdir(filepath.Join(repo, "sub"), 0755)
+	os.Chdir(filepath.Join(repo, "sub"))
+
+	tests := []struct {
+		scope string
+		want  string
+	}{
+		{scopeUser, filepath.Join(home, ".claude", "settings.json")},
+		{scopeProject, filepath.Join(root, ".claude", "settings.json")},
+		{scopeLocal, filepath.Join(root, ".claude", "settings.local.json")},
+	}
+	for _, tt := range tests {
+		got, err := scopeSettingsPath(tt.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("scopeSettingsPath(%s) = %s, want %s", tt.scope, got, tt.want)
+		}
+	}
+	if _, err := scopeSettingsPath("global"); err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+}
+
+func TestInstallScopes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := initTestRepo(t)
+
+	runInstall([]string{"--scope", "project"})
+	runInstall([]string{"--scope", "local"})
+
+	project := readHookStatus(filepath.Join(repo, ".claude", "settings.json"))
+	if len(project.Events) != 2 || len(project.Commands) != 1 || project.Commands[0] != "icc hook" {
+		t.Errorf("project scope = %+v, want icc hook from PATH for both events", project)
+	}
+	local := readHookStatus(filepath.Join(repo, ".claude", "settings.local.json"))
+	if len(local.Commands) != 1 || local.Commands[0] != hookCommand() {
+		t.Errorf("local scope = %+v, want %s", local, hookCommand())
+	}
+	user, _ := scopeSettingsPath(scopeUser)
+	if fileExists(user) {
+		t.Error("user settings written for project and local scopes")
+	}
+
+	runUninstall([]string{"--scope", "local"})
+	if st := readHookStatus(filepath.Join(repo, ".claude", "settings.local.json")); len(st.Commands) != 0 {
+		t.Errorf("local scope still has %v after uninstall", st.Commands)
+	}
+	if st := readHookStatus(filepath.Join(repo, ".claude", "settings.json")); len(st.Commands) != 1 {
+		t.Error("uninstalling the local scope touched the project scope")
+	}
+}
+
+func TestReadHookStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if st := readHookStatus(path); len(st.Events) != 0 {
+		t.Errorf("missing file: %+v", st)
+	}
+	writeTestFile(path, `{"hooks":{"PreToolUse":[{"hooks":[{"command":"/opt/icc hook"},{"command":"other.sh"}]}]}}`)
+	st := readHookStatus(path)
+	if strings.Join(st.Events, ",") != "PreToolUse" || strings.Join(st.Commands, ",") != "/opt/icc hook" {
+		t.Errorf("got %+v, want /opt/icc hook for PreToolUse only", st)
+	}
+}
+
+func TestHookCommandVersion(t *testing.T) {
+	if got := hookCommandVersion(legacyHookCmd); !strings.HasPrefix(got, "legacy context-guard.sh") {
+		t.Errorf("legacy script: %q", got)
+	}
+	if got := hookCommandVersion("icc-not-installed-anywhere hook"); got != "icc-not-installed-anywhere not found in PATH" {
+		t.Errorf("missing binary: %q", got)
+	}
+
+	if got := hookCommandVersion(hookCommand()); got != "icc "+version {
+		t.Errorf("this binary: %q", got)
+	}
+
+	// A binary named by settings is only run when it is the icc in PATH.
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "icc")
+	ran := filepath.Join(dir, "ran")
+	writeTestFile(exe, "#!/bin/sh\ntouch "+ran+"\necho v9.9.9\n")
+	os.Chmod(exe, 0755)
+	t.Setenv("PATH", t.TempDir())
+	if got := hookCommandVersion(exe + " hook"); !strings.HasSuffix(got, foreignHookBinary) || fileExists(ran) {
+		t.Errorf("foreign binary: %q, ran: %v", got, fileExists(ran))
+	}
+	t.Setenv("PATH", dir)
+	if got := hookCommandVersion(exe + " hook"); got != "icc v9.9.9" {
+		t.Errorf("icc in PATH: %q", got)
+	}
+	if got := hookCommandVersion("icc hook"); got != "icc v9.9.9" {
+		t.Errorf("icc from PATH: %q", got)
+	}
+}
+
+func TestRegisterHooksKeepsFormatting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	original := `{
+    "permissions": {"allow": ["Bash(ls:*)"]},
+    "model": "opus",
+    "hooks": {
+        "Stop": [{"hooks": [{"type": "command", "command": "notify.sh"}]}]
+    },
+    "env": {"A": "1"}
+}
+`
+	writeTestFile(path, original)
+
+	before, after, err := registerHooks(path, "/opt/icc hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != original {
+		t.Fatal("before is not the file content")
+	}
+	want := `        "Stop": [{"hooks": [{"type": "command", "command": "notify.sh"}]}],
+        "PreToolUse": [
+            {
+                "hooks": [
+                    {
+                        "type": "command",
+                        "command": "/opt/icc hook",
+                        "timeout": 10
+                    }
+                ]
+            }
+        ],`
+	if !strings.Contains(after, want) || !strings.HasPrefix(after, `{
+    "permissions": {"allow": ["Bash(ls:*)"]},
+    "model": "opus",`) || !strings.HasSuffix(after, "    \"env\": {\"A\": \"1\"}\n}\n") {
+		t.Errorf("registered settings lost the file's order or formatting:\n%s", after)
+	}
+
+	if _, err := writeSettings(path, before, after); err != nil {
+		t.Fatal(err)
+	}
+	_, restored, n, err := unregisterHooks(path)
+	if err != nil || n != 2 {
+		t.Fatalf("unregisterHooks: %d removed, %v", n, err)
+	}
+	if restored != original {
+		t.Errorf("install then uninstall changed the file:\n%s", unifiedDiff("original", "restored", original, restored))
+	}
+}
+
+func TestWriteSettings(t *testing.T) {
+	t.Run("new file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".claude", "settings.json")
+		backup, err := writeSettings(path, "", "{}\n")
+		if err != nil || backup != "" {
+			t.Fatalf("got (%q, %v), want no backup", backup, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "{}\n" {
+			t.Errorf("wrote %q", data)
+		}
+	})
+
+	t.Run("backs up and keeps the mode", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		writeTestFile(path, `{"a": 1}`)
+		os.Chmod(path, 0600)
+		first, err := writeSettings(path, `{"a": 1}`, `{"a": 2}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := writeSettings(path, `{"a": 2}`, `{"a": 3}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == second {
+			t.Fatalf("second backup %s replaced the first", second)
+		}
+		for backup, want := range map[string]string{first: `{"a": 1}`, second: `{"a": 2}`} {
+			if data, _ := os.ReadFile(backup); string(data) != want {
+				t.Errorf("%s holds %q, want %q", backup, data, want)
+			}
+		}
+		fi, _ := os.Stat(path)
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("mode = %v, want 0600", fi.Mode().Perm())
+		}
+		if tmp, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".settings.json.tmp-*")); len(tmp) > 0 {
+			t.Errorf("temporary files left: %v", tmp)
+		}
+	})
+
+	t.Run("refuses a file changed since it was read", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		writeTestFile(path, `{"a": 1, "edited": true}`)
+		if _, err := writeSettings(path, `{"a": 1}`, `{"a": 2}`); err == nil || !strings.Contains(err.Error(), "changed") {
+			t.Errorf("err = %v, want a changed-file error", err)
+		}
+		if _, err := writeSettings(filepath.Join(t.TempDir(), "gone.json"), `{"a": 1}`, `{"a": 2}`); err == nil {
+			t.Error("expected an error for a file deleted since it was read")
+		}
+		if data, _ := os.ReadFile(path); string(data) != `{"a": 1, "edited": true}` {
+			t.Errorf("file was written: %s", data)
+		}
+		if backups, _ := filepath.Glob(path + ".bak-*"); len(backups) > 0 {
+			t.Errorf("backup written: %v", backups)
+		}
+	})
+
+	t.Run("writes through a symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		real := filepath.Join(dir, "dotfiles-settings.json")
+		link := filepath.Join(dir, "settings.json")
+		writeTestFile(real, `{}`)
+		os.Symlink(real, link)
+		if _, err := writeSettings(link, `{}`, `{"a": 1}`); err != nil {
+			t.Fatal(err)
+		}
+		if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Error("symlink was replaced")
+		}
+		if data, _ := os.ReadFile(real); string(data) != `{"a": 1}` {
+			t.Errorf("link target holds %q", data)
+		}
+	})
+}
+
+func TestRunInstallDryRun(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, ".claude", "settings.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	writeTestFile(path, `{"model": "opus"}`)
+
+	runInstall([]string{"--dry-run"})
+	if data, _ := os.ReadFile(path); string(data) != `{"model": "opus"}` {
+		t.Errorf("--dry-run wrote %s", data)
+	}
+	if backups, _ := filepath.Glob(path + ".bak-*"); len(backups) > 0 {
+		t.Errorf("--dry-run wrote a backup: %v", backups)
+	}
+}
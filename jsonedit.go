@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonDoc edits a JSON document in place: each edit splices the text of
+// the values it changes and leaves everything else, key order, spacing
+// and indentation included, as it was. Values added are indented to match
+// their surroundings.
+//
+// Every edit reparses the document, so values found before an edit are
+// stale after it; look them up again with at.
+type jsonDoc struct {
+	text string
+	root *jsonValue
+}
+
+// jsonValue is one value of a jsonDoc: text[Start:End].
+type jsonValue struct {
+	Kind       byte // '{', '[', '"', or 0 for numbers, true, false and null
+	Start, End int
+	Members    []jsonMember // of an object
+	Elems      []*jsonValue // of an array
+}
+
+// jsonMember is an object member; text[Start:KeyEnd] is its quoted key.
+type jsonMember struct {
+	Key           string
+	Start, KeyEnd int
+	Value         *jsonValue
+}
+
+func parseJSONDoc(text string) (*jsonDoc, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return nil, err
+	}
+	p := jsonParser{s: text}
+	return &jsonDoc{text: text, root: p.value()}, nil
+}
+
+// jsonParser finds the spans of a document already known to be valid.
+type jsonParser struct {
+	s string
+	i int
+}
+
+func (p *jsonParser) space() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *jsonParser) value() *jsonValue {
+	p.space()
+	v := &jsonValue{Start: p.i}
+	switch c := p.s[p.i]; c {
+	case '{', '[':
+		v.Kind = c
+		p.i++
+		for {
+			p.space()
+			if p.s[p.i] == '}' || p.s[p.i] == ']' {
+				p.i++
+				break
+			}
+			if p.s[p.i] == ',' {
+				p.i++
+				continue
+			}
+			if c == '[' {
+				v.Elems = append(v.Elems, p.value())
+				continue
+			}
+			m := jsonMember{Start: p.i}
+			p.str()
+			m.KeyEnd = p.i
+			json.Unmarshal([]byte(p.s[m.Start:m.KeyEnd]), &m.Key)
+			p.space()
+			p.i++ // ':'
+			m.Value = p.value()
+			v.Members = append(v.Members, m)
+		}
+	case '"':
+		v.Kind = c
+		p.str()
+	default:
+		for p.i < len(p.s) && strings.IndexByte(",]} \t\r\n", p.s[p.i]) < 0 {
+			p.i++
+		}
+	}
+	v.End = p.i
+	return v
+}
+
+// str skips a string, quotes included.
+func (p *jsonParser) str() {
+	for p.i++; p.s[p.i] != '"'; p.i++ {
+		if p.s[p.i] == '\\' {
+			p.i++
+		}
+	}
+	p.i++
+}
+
+// member returns the value of an object's member key, or nil. Like
+// elems, it is safe on nil and on values of another kind.
+func (v *jsonValue) member(key string) *jsonValue {
+	if i := v.memberIndex(key); i >= 0 {
+		return v.Members[i].Value
+	}
+	return nil
+}
+
+// memberIndex returns the index of an object's member key, or -1.
+func (v *jsonValue) memberIndex(key string) int {
+	if v == nil {
+		return -1
+	}
+	for i, m := range v.Members {
+		if m.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// elems returns the elements of an array, or nil for anything else.
+func (v *jsonValue) elems() []*jsonValue {
+	if v == nil {
+		return nil
+	}
+	return v.Elems
+}
+
+// at returns the value at path, where each step is a member key (string)
+// or an array index (int), or nil if there is none.
+func (d *jsonDoc) at(path ...interface{}) *jsonValue {
+	v := d.root
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			v = v.member(s)
+		case int:
+			if s >= 0 && s < len(v.Elems) {
+				v = v.Elems[s]
+			} else {
+				v = nil
+			}
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// str returns the content of a string value, or "" for any other value.
+func (d *jsonDoc) str(v *jsonValue) string {
+	var s string
+	if v != nil && v.Kind == '"' {
+		json.Unmarshal([]byte(d.text[v.Start:v.End]), &s)
+	}
+	return s
+}
+
+// replace replaces v with value.
+func (d *jsonDoc) replace(v *jsonValue, value interface{}) error {
+	text, err := d.marshal(value, d.lineIndent(v.Start), !d.compact())
+	if err != nil {
+		return err
+	}
+	return d.splice(v.Start, v.End, text)
+}
+
+// appendElem appends value to the array arr.
+func (d *jsonDoc) appendElem(arr *jsonValue, value interface{}) error {
+	return d.insert(arr, "", value)
+}
+
+// addMember appends the member key to the object obj.
+func (d *jsonDoc) addMember(obj *jsonValue, key string, value interface{}) error {
+	return d.insert(obj, key, value)
+}
+
+// insert appends value, as the member key if c is an object, after the
+// last item of c: on its own line if c spans lines, else on the same line.
+func (d *jsonDoc) insert(c *jsonValue, key string, value interface{}) error {
+	items := d.items(c)
+	multiline := strings.Contains(d.text[c.Start:c.End], "\n") || len(items) == 0 && !d.compact()
+
+	indent := ""
+	if multiline {
+		indent = d.lineIndent(c.Start) + d.indentUnit()
+		if len(items) > 0 {
+			indent = d.lineIndent(items[len(items)-1][0])
+		}
+	}
+	text, err := d.marshal(value, indent, multiline)
+	if err != nil {
+		return err
+	}
+	if c.Kind == '{' {
+		k, _ := json.Marshal(key)
+		text = string(k) + d.colon(c) + text
+	}
+
+	switch {
+	case len(items) == 0 && multiline:
+		return d.splice(c.Start+1, c.End-1, "\n"+indent+text+"\n"+d.lineIndent(c.Start))
+	case len(items) == 0:
+		return d.splice(c.Start+1, c.End-1, text)
+	case multiline:
+		end := items[len(items)-1][1]
+		return d.splice(end, end, ",\n"+indent+text)
+	}
+	sep := ", "
+	if len(items) > 1 {
+		sep = d.text[items[0][1]:items[1][0]]
+	} else if d.compact() {
+		sep = ","
+	}
+	end := items[len(items)-1][1]
+	return d.splice(end, end, sep+text)
+}
+
+// remove removes the items at indexes from the array or object c,
+// with the commas and line breaks that separate them.
+func (d *jsonDoc) remove(c *jsonValue, indexes ...int) error {
+	items := d.items(c)
+	removed := map[int]bool{}
+	for _, i := range indexes {
+		removed[i] = true
+	}
+	first := -1 // the first item kept
+	for i := range items {
+		if !removed[i] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return d.splice(c.Start+1, c.End-1, "")
+	}
+
+	// Items before the first kept one go with the separator after them,
+	// later ones with the separator before them. The spans do not overlap,
+	// so they are cut from the end.
+	type span struct{ start, end int }
+	var spans []span
+	if first > 0 {
+		spans = append(spans, span{items[0][0], items[first][0]})
+	}
+	for i := first + 1; i < len(items); i++ {
+		if removed[i] {
+			spans = append(spans, span{items[i-1][1], items[i][1]})
+		}
+	}
+	text := d.text
+	for i := len(spans) - 1; i >= 0; i-- {
+		text = text[:spans[i].start] + text[spans[i].end:]
+	}
+	return d.setText(text)
+}
+
+// items returns the start and end of each element or member of c; a
+// member starts at its key.
+func (d *jsonDoc) items(c *jsonValue) [][2]int {
+	var items [][2]int
+	for _, m := range c.Members {
+		items = append(items, [2]int{m.Start, m.Value.End})
+	}
+	for _, e := range c.Elems {
+		items = append(items, [2]int{e.Start, e.End})
+	}
+	return items
+}
+
+func (d *jsonDoc) splice(start, end int, text string) error {
+	return d.setText(d.text[:start] + text + d.text[end:])
+}
+
+func (d *jsonDoc) setText(text string) error {
+	doc, err := parseJSONDoc(text)
+	if err != nil {
+		return fmt.Errorf("edit produced invalid JSON: %w", err)
+	}
+	*d = *doc
+	return nil
+}
+
+// compact reports whether the document is on one line, as written by
+// json.Marshal. Values added to it are not indented.
+func (d *jsonDoc) compact() bool {
+	return !strings.Contains(strings.TrimSpace(d.text), "\n") && len(d.items(d.root)) > 0
+}
+
+// indentUnit is the indentation of the document's first indented line,
+// or two spaces.
+func (d *jsonDoc) indentUnit() string {
+	for _, line := range strings.Split(d.text, "\n") {
+		if indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]; indent != "" {
+			return indent
+		}
+	}
+	return "  "
+}
+
+// lineIndent is the leading whitespace of the line containing pos.
+func (d *jsonDoc) lineIndent(pos int) string {
+	line := d.text[strings.LastIndexByte(d.text[:pos], '\n')+1:]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// colon is what separates keys from values in obj: what its first member
+// uses, else ": ", or ":" in a compact document.
+func (d *jsonDoc) colon(obj *jsonValue) string {
+	if len(obj.Members) > 0 {
+		m := obj.Members[0]
+		return d.text[m.KeyEnd:m.Value.Start]
+	}
+	if d.compact() {
+		return ":"
+	}
+	return ": "
+}
+
+// marshal encodes value compact, or indented with the document's unit
+// from indent, the indentation of the line it starts on. HTML characters
+// are not escaped; shell commands are full of them.
+func (d *jsonDoc) marshal(value interface{}, indent string, indented bool) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indented {
+		enc.SetIndent(indent, d.indentUnit())
+	}
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
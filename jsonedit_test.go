@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJSONDocEdits(t *testing.T) {
+	type hook struct {
+		Command string `json:"command"`
+	}
+	tests := []struct {
+		name string
+		in   string
+		edit func(d *jsonDoc) error
+		want string
+	}{
+		{
+			name: "append to a multiline array",
+			in:   "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": true\n}\n",
+			edit: func(d *jsonDoc) error { return d.appendElem(d.at("a"), 3) },
+			want: "{\n  \"a\": [\n    1,\n    2,\n    3\n  ],\n  \"b\": true\n}\n",
+		},
+		{
+			name: "append to a one-line array",
+			in:   "{\n  \"a\": [1, 2]\n}",
+			edit: func(d *jsonDoc) error { return d.appendElem(d.at("a"), hook{"x && y"}) },
+			want: "{\n  \"a\": [1, 2, {\"command\":\"x && y\"}]\n}",
+		},
+		{
+			name: "add a member with tabs",
+			in:   "{\n\t\"z\": 1,\n\t\"a\": {}\n}",
+			edit: func(d *jsonDoc) error { return d.addMember(d.at("a"), "k", []int{1}) },
+			want: "{\n\t\"z\": 1,\n\t\"a\": {\n\t\t\"k\": [\n\t\t\t1\n\t\t]\n\t}\n}",
+		},
+		{
+			name: "add a member to an empty file",
+			in:   "{}\n",
+			edit: func(d *jsonDoc) error { return d.addMember(d.root, "k", "v") },
+			want: "{\n  \"k\": \"v\"\n}\n",
+		},
+		{
+			name: "add a member to a compact document",
+			in:   `{"b":1}`,
+			edit: func(d *jsonDoc) error { return d.addMember(d.root, "a", map[string]int{"x": 1}) },
+			want: `{"b":1,"a":{"x":1}}`,
+		},
+		{
+			name: "replace a string",
+			in:   `{"c": "old \"one\"", "d": "é"}`,
+			edit: func(d *jsonDoc) error { return d.replace(d.at("c"), "new") },
+			want: `{"c": "new", "d": "é"}`,
+		},
+		{
+			name: "remove the first item",
+			in:   "[\n  1,\n  2,\n  3\n]",
+			edit: func(d *jsonDoc) error { return d.remove(d.root, 0) },
+			want: "[\n  2,\n  3\n]",
+		},
+		{
+			name: "remove the last item",
+			in:   "[\n  1,\n  2,\n  3\n]",
+			edit: func(d *jsonDoc) error { return d.remove(d.root, 2) },
+			want: "[\n  1,\n  2\n]",
+		},
+		{
+			name: "remove items around a kept one",
+			in:   `{"a": 1, "b": 2, "c": 3, "d": 4}`,
+			edit: func(d *jsonDoc) error { return d.remove(d.root, 0, 2, 3) },
+			want: `{"b": 2}`,
+		},
+		{
+			name: "remove every item",
+			in:   "{\n  \"a\": [\n    1\n  ]\n}",
+			edit: func(d *jsonDoc) error { return d.remove(d.at("a"), 0) },
+			want: "{\n  \"a\": []\n}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := parseJSONDoc(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.edit(d); err != nil {
+				t.Fatal(err)
+			}
+			if d.text != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", d.text, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONDocAt(t *testing.T) {
+	d, err := parseJSONDoc(`{"hooks": {"Pre": [{"command": "a\"b"}, 2]}, "n": null}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.str(d.at("hooks", "Pre", 0, "command")); got != `a"b` {
+		t.Errorf("command = %q", got)
+	}
+	if v := d.at("hooks", "Pre", 5); v != nil {
+		t.Error("index out of range found a value")
+	}
+	if v := d.at("n", "x"); v != nil {
+		t.Error("member of null found a value")
+	}
+	if n := len(d.at("hooks", "Pre", 1).member("x").elems()); n != 0 {
+		t.Error("elems of a missing value")
+	}
+	if _, err := parseJSONDoc(`{"a": 1,}`); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
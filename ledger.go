@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ledgerFile is the cumulative ledger in the run directory.
+const ledgerFile = "ledger.md"
+
+// ledgerBudget caps the ledger text injected into a continuation prompt,
+// in bytes. The newest entries are kept.
+const ledgerBudget = 6000
+
+// ledgerEntry is one dead end or decision recorded in a handoff.
+type ledgerEntry struct {
+	Session int
+	Text    string
+}
+
+// ledger collects the Q2 (dead ends) and Q3 (decisions) answers of every
+// handoff in a run, deduplicated, so later sessions do not rediscover them.
+type ledger struct {
+	DeadEnds  []ledgerEntry
+	Decisions []ledgerEntry
+}
+
+var (
+	listItemRe  = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+	ledgerKeyRe = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// buildLedger extracts the ledger from the sessions' parsed handoffs.
+// An item repeated in a later handoff keeps its first session.
+func buildLedger(sessions []sessionRecord) ledger {
+	var l ledger
+	seen := map[string]bool{}
+	add := func(list *[]ledgerEntry, session int, body string) {
+		for _, item := range ledgerItems(body) {
+			key := strings.Trim(ledgerKeyRe.ReplaceAllString(strings.ToLower(item), " "), " ")
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			*list = append(*list, ledgerEntry{session, item})
+		}
+	}
+	for _, s := range sessions {
+		if s.Handoff == nil {
+			continue
+		}
+		add(&l.DeadEnds, s.Number, s.Handoff.answer("Q2"))
+		add(&l.Decisions, s.Number, s.Handoff.answer("Q3"))
+	}
+	return l
+}
+
+// ledgerItems splits a section into items: list items, or paragraphs when
+// the section is not a list. Lines under a list item belong to it.
+func ledgerItems(body string) []string {
+	var items []string
+	var cur []string
+	flush := func() {
+		if len(cur) > 0 {
+			items = append(items, strings.Join(cur, " "))
+			cur = nil
+		}
+	}
+	for _, line := range splitLines(body) {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case listItemRe.MatchString(line):
+			flush()
+			cur = append(cur, strings.TrimSpace(listItemRe.ReplaceAllString(line, "")))
+		default:
+			cur = append(cur, trimmed)
+		}
+	}
+	flush()
+	return items
+}
+
+func (l ledger) empty() bool {
+	return len(l.DeadEnds) == 0 && len(l.Decisions) == 0
+}
+
+// markdown renders the whole ledger, as written to ledger.md.
+func (l ledger) markdown() string {
+	var b strings.Builder
+	b.WriteString("# Dead ends\n\n")
+	writeLedgerEntries(&b, l.DeadEnds)
+	b.WriteString("\n# Decisions\n\n")
+	writeLedgerEntries(&b, l.Decisions)
+	return b.String()
+}
+
+func writeLedgerEntries(b *strings.Builder, entries []ledgerEntry) {
+	if len(entries) == 0 {
+		b.WriteString("(none yet)\n")
+	}
+	for _, e := range entries {
+		fmt.Fprintf(b, "- [s%d] %s\n", e.Session, e.Text)
+	}
+}
+
+// prompt renders the ledger for a continuation prompt, leaving out the
+// entries of session exclude (the handoff shown in full) and dropping the
+// oldest entries beyond budget bytes. It returns "" when nothing is left.
+func (l ledger) prompt(exclude, budget int) string {
+	keep := func(entries []ledgerEntry) []ledgerEntry {
+		var out []ledgerEntry
+		for _, e := range entries {
+			if e.Session != exclude {
+				out = append(out, e)
+			}
+		}
+		return out
+	}
+	deadEnds, decisions := keep(l.DeadEnds), keep(l.Decisions)
+	if len(deadEnds)+len(decisions) == 0 {
+		return ""
+	}
+
+	// Spend the budget newest first, dead ends before decisions.
+	omitted := 0
+	used := 0
+	fit := func(entries []ledgerEntry) []ledgerEntry {
+		n := 0
+		for i := len(entries) - 1; i >= 0; i-- {
+			size := len(entries[i].Text) + 10
+			if used+size > budget {
+				break
+			}
+			used += size
+			n++
+		}
+		omitted += len(entries) - n
+		return entries[len(entries)-n:]
+	}
+	deadEnds = fit(deadEnds)
+	decisions = fit(decisions)
+
+	var b strings.Builder
+	if len(deadEnds) > 0 {
+		b.WriteString("Dead ends (do not retry these):\n")
+		writeLedgerEntries(&b, deadEnds)
+	}
+	if len(decisions) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Decisions (keep them unless you find a real problem):\n")
+		writeLedgerEntries(&b, decisions)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "\n(%d older entries omitted, see the full ledger)\n", omitted)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// writeLedger rebuilds ledger.md in the run directory from the handoffs
+// recorded so far.
+func writeLedger(run *runManifest) error {
+	l := buildLedger(run.Sessions)
+	if l.empty() {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(run.Dir, ledgerFile), []byte(l.markdown()), 0600)
+}
+
+// setLedger fills the ledger fields of the continuation prompt for the
+// session after prev.
+func (d *promptData) setLedger(run *runManifest, prev int) {
+	d.Ledger = buildLedger(run.Sessions).prompt(prev, ledgerBudget)
+	if d.Ledger != "" {
+		d.LedgerPath = filepath.Join(run.Dir, ledgerFile)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLedgerItems(t *testing.T) {
+	got := ledgerItems("- sqlite :memory: loses data between connections\n  (each connection gets its own db)\n* mocking time.Now is flaky\n1. CGO builds fail on CI")
+	want := []string{
+		"sqlite :memory: loses data between connections (each connection gets its own db)",
+		"mocking time.Now is flaky",
+		"CGO builds fail on CI",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("ledgerItems = %q", got)
+	}
+
+	got = ledgerItems("Plain paragraph one\ncontinued.\n\nParagraph two.")
+	if len(got) != 2 || got[0] != "Plain paragraph one continued." {
+		t.Errorf("paragraphs = %q", got)
+	}
+}
+
+func ledgerSessions() []sessionRecord {
+	return []sessionRecord{
+		{Number: 1, Handoff: parseHandoff("## Q0\nx\n## Q2\n- Redis pub/sub drops messages\n## Q3\n- Chose chi over gin for stdlib handlers")},
+		{Number: 2, Outcome: "crashed"},
+		{Number: 3, Handoff: parseHandoff("## Q0\nx\n## Q2\n- redis pub/sub drops messages!\n- Bulk insert hits the 999 parameter limit\n## Q3\nNone")},
+		{Number: 4, Handoff: parseHandoff("## Q0\nx\n## Q2\n- Vendoring breaks go generate")},
+	}
+}
+
+func TestBuildLedger(t *testing.T) {
+	l := buildLedger(ledgerSessions())
+	if len(l.DeadEnds) != 3 {
+		t.Fatalf("DeadEnds = %+v, want the duplicate merged", l.DeadEnds)
+	}
+	if l.DeadEnds[0].Session != 1 || l.DeadEnds[1].Text != "Bulk insert hits the 999 parameter limit" {
+		t.Errorf("DeadEnds = %+v", l.DeadEnds)
+	}
+	if len(l.Decisions) != 1 {
+		t.Errorf("Decisions = %+v", l.Decisions)
+	}
+	md := l.markdown()
+	for _, want := range []string{"# Dead ends", "- [s1] Redis pub/sub drops messages", "# Decisions", "- [s1] Chose chi"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestLedgerPrompt(t *testing.T) {
+	l := buildLedger(ledgerSessions())
+
+	got := l.prompt(4, ledgerBudget)
+	if strings.Contains(got, "Vendoring") {
+		t.Error("entries of the previous session are shown in its handoff and should be left out")
+	}
+	if !strings.Contains(got, "Dead ends (do not retry these):\n- [s1] Redis") || !strings.Contains(got, "Decisions") {
+		t.Errorf("prompt:\n%s", got)
+	}
+
+	got = l.prompt(4, 60)
+	if strings.Contains(got, "Redis") || !strings.Contains(got, "Bulk insert") || !strings.Contains(got, "2 older entries omitted") {
+		t.Errorf("over budget, the newest entries should be kept:\n%s", got)
+	}
+
+	if got := (ledger{}).prompt(1, ledgerBudget); got != "" {
+		t.Errorf("empty ledger prompt = %q", got)
+	}
+}
+
+func TestWriteLedger(t *testing.T) {
+	run := &runManifest{Dir: t.TempDir()}
+	if err := writeLedger(run); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(filepath.Join(run.Dir, ledgerFile)) {
+		t.Error("no ledger file should be written before there are entries")
+	}
+
+	run.Sessions = ledgerSessions()
+	if err := writeLedger(run); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(run.Dir, ledgerFile))
+	if err != nil || !strings.Contains(string(data), "Vendoring breaks go generate") {
+		t.Errorf("ledger.md = %q, %v", data, err)
+	}
+
+	var d promptData
+	d.setLedger(run, 4)
+	if d.Ledger == "" || d.LedgerPath != filepath.Join(run.Dir, ledgerFile) {
+		t.Errorf("setLedger = %q, %q", d.Ledger, d.LedgerPath)
+	}
+}
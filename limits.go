@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pane condition kinds.
+const (
+	conditionRateLimit = "rate-limit" // wait until the reset time, then continue
+	conditionAPIError  = "api-error"  // retry with exponential backoff
+)
+
+// paneCondition classifies a pane line that means claude stopped for a
+// reason outside the agent's control.
+type paneCondition struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`  // rate-limit or api-error
+	Match string `json:"match"` // regexp matched against each pane line
+
+	re *regexp.Regexp
+}
+
+// defaultPaneConditions lists the messages known from current claude versions.
+var defaultPaneConditions = []paneCondition{
+	{Name: "usage-limit", Kind: conditionRateLimit, Match: `(?i)usage limit reached|limit reached.*resets?\b|you've hit your (usage )?limit`},
+	{Name: "rate-limited", Kind: conditionAPIError, Match: `API Error:?\s*429|rate_limit_error`},
+	{Name: "overloaded", Kind: conditionAPIError, Match: `API Error:?\s*5\d\d|overloaded_error`},
+	{Name: "connection", Kind: conditionAPIError, Match: `(?i)API Error:?\s*(connection error|request timed out)`},
+}
+
+// paneConditionsPath returns the config file that extends the condition
+// table. ICC_PANE_CONDITIONS overrides the project-level
+// .icc/pane-conditions.json.
+func paneConditionsPath() string {
+	return envOrDefault("ICC_PANE_CONDITIONS", filepath.Join(".icc", "pane-conditions.json"))
+}
+
+// loadPaneConditions returns the configured conditions followed by the
+// defaults. A configured condition with the same name as a default
+// replaces it. A missing config file is not an error.
+func loadPaneConditions(path string) ([]paneCondition, error) {
+	var custom []paneCondition
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	overridden := map[string]bool{}
+	for _, c := range custom {
+		overridden[c.Name] = true
+	}
+	conditions := append([]paneCondition{}, custom...)
+	for _, c := range defaultPaneConditions {
+		if !overridden[c.Name] {
+			conditions = append(conditions, c)
+		}
+	}
+
+	for i := range conditions {
+		c := &conditions[i]
+		if c.Kind != conditionRateLimit && c.Kind != conditionAPIError {
+			return nil, fmt.Errorf("pane condition %q: unknown kind %q", c.Name, c.Kind)
+		}
+		re, err := regexp.Compile(c.Match)
+		if err != nil {
+			return nil, fmt.Errorf("pane condition %q: %w", c.Name, err)
+		}
+		c.re = re
+	}
+	return conditions, nil
+}
+
+// conditionMatch is one occurrence of a pane condition.
+type conditionMatch struct {
+	Condition *paneCondition
+	Line      string
+}
+
+// classifyPane returns every line of text that matches a condition, in
+// pane order. Each line is attributed to the first matching condition.
+func classifyPane(conditions []paneCondition, text string) []conditionMatch {
+	var matches []conditionMatch
+	for _, line := range splitLines(text) {
+		for i := range conditions {
+			if conditions[i].re != nil && conditions[i].re.MatchString(line) {
+				matches = append(matches, conditionMatch{&conditions[i], strings.TrimSpace(line)})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// conditionLines is how much of the bottom of the pane is searched for
+// conditions. Claude prints its error just above the input box; the rest of
+// the pane is agent output, where the same text (a test log, a grep
+// result) is not an incident.
+const conditionLines = 12
+
+// conditionTracker decides when a pane condition is acted on, and counts
+// the consecutive attempts that size the backoff.
+type conditionTracker struct {
+	handled  string // pane text last acted on
+	attempts int
+}
+
+// observe takes a pane snapshot and whether it is unchanged since the
+// previous one. It returns the condition to act on and its attempt number,
+// or ok false. A condition is acted on once claude has stopped redrawing,
+// i.e. its own retries are over, and only once per pane state. A pane that
+// changes with no condition at its bottom is progress: the count restarts.
+func (t *conditionTracker) observe(conditions []paneCondition, text string, stable bool) (m conditionMatch, attempt int, ok bool) {
+	matches := classifyPane(conditions, lastLines(text, conditionLines))
+	if len(matches) == 0 {
+		if !stable {
+			t.attempts = 0
+		}
+		return conditionMatch{}, 0, false
+	}
+	if !stable || text == t.handled {
+		return conditionMatch{}, 0, false
+	}
+	t.handled = text
+	t.attempts++
+	return matches[len(matches)-1], t.attempts, true
+}
+
+var (
+	resetTimeRe  = regexp.MustCompile(`(?i)resets?\s+(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?(?:\s*\(([^)]+)\))?`)
+	resetEpochRe = regexp.MustCompile(`\|(\d{10})\b`)
+)
+
+// parseResetTime extracts the reset time from a usage-limit message, e.g.
+// "resets 3pm (Europe/Berlin)", "reset at 15:30" or the older
+// "usage limit reached|1767268800" form, and returns its next occurrence
+// after now.
+func parseResetTime(line string, now time.Time) (time.Time, bool) {
+	if m := resetEpochRe.FindStringSubmatch(line); m != nil {
+		sec, _ := strconv.ParseInt(m[1], 10, 64)
+		if reset := time.Unix(sec, 0); reset.After(now) {
+			return reset, true
+		}
+	}
+	m := resetTimeRe.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	switch strings.ToLower(m[3]) {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, false
+	}
+
+	loc := now.Location()
+	if m[4] != "" {
+		if l, err := time.LoadLocation(m[4]); err == nil {
+			loc = l
+		}
+	}
+	local := now.In(loc)
+	reset := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+	if !reset.After(local) {
+		reset = reset.AddDate(0, 0, 1)
+	}
+	return reset, true
+}
+
+// Waits applied to pane conditions.
+const (
+	rateLimitFallbackWait = 30 * time.Minute // reset time not shown or not parsable
+	rateLimitMargin       = time.Minute      // slack after the advertised reset
+	apiErrorBaseWait      = 30 * time.Second
+	apiErrorMaxWait       = 10 * time.Minute
+)
+
+// conditionWait returns how long to pause before sending "continue" for the
+// attempt-th consecutive occurrence (starting at 1) of a condition.
+func conditionWait(m conditionMatch, attempt int, now time.Time) time.Duration {
+	if m.Condition.Kind == conditionRateLimit {
+		if reset, ok := parseResetTime(m.Line, now); ok {
+			return reset.Sub(now) + rateLimitMargin
+		}
+		return rateLimitFallbackWait
+	}
+	wait := apiErrorBaseWait
+	for i := 1; i < attempt && wait < apiErrorMaxWait; i++ {
+		wait *= 2
+	}
+	if wait > apiErrorMaxWait {
+		wait = apiErrorMaxWait
+	}
+	return wait
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyPane(t *testing.T) {
+	conditions, err := loadPaneConditions("/nonexistent/pane-conditions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pane string
+		want []string // condition kinds in order
+	}{
+		{"usage limit", "⏺ Working\n  ⎿  Claude usage limit reached. Your limit will reset at 3pm (Europe/Berlin).\n❯", []string{conditionRateLimit}},
+		{"five hour limit", "5-hour limit reached ∙ resets 3pm", []string{conditionRateLimit}},
+		{"legacy usage limit", "Claude AI usage limit reached|1767268800", []string{conditionRateLimit}},
+		{"overloaded", `API Error: 529 {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, []string{conditionAPIError}},
+		{"server error", "API Error: 500 Internal server error", []string{conditionAPIError}},
+		{"two incidents", "API Error: 529 Overloaded\ncontinue\nAPI Error: 529 Overloaded", []string{conditionAPIError, conditionAPIError}},
+		{"normal output", "⏺ Fixed the 500 handler in server.go\n❯", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyPane(conditions, tt.pane)
+			if len(got) != len(tt.want) {
+				t.Fatalf("classifyPane returned %d matches %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if got[i].Condition.Kind != tt.want[i] {
+					t.Errorf("match %d kind = %q, want %q", i, got[i].Condition.Kind, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConditionTracker(t *testing.T) {
+	conditions, err := loadPaneConditions("/nonexistent/pane-conditions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filler := strings.Repeat("⏺ working\n", conditionLines)
+	errorPane := "⏺ Running tests\n  ⎿  API Error: 529 Overloaded\n❯"
+
+	var tr conditionTracker
+	if _, _, ok := tr.observe(conditions, errorPane, false); ok {
+		t.Error("acted while claude was still redrawing")
+	}
+	if _, attempt, ok := tr.observe(conditions, errorPane, true); !ok || attempt != 1 {
+		t.Fatalf("got (%d, %v), want attempt 1", attempt, ok)
+	}
+	if _, _, ok := tr.observe(conditions, errorPane, true); ok {
+		t.Error("acted twice on the same pane")
+	}
+	retried := errorPane + " continue\n  ⎿  API Error: 529 Overloaded\n❯"
+	if _, attempt, ok := tr.observe(conditions, retried, true); !ok || attempt != 2 {
+		t.Fatalf("got (%d, %v), want attempt 2", attempt, ok)
+	}
+
+	// Progress without an error restarts the backoff.
+	tr.observe(conditions, retried+"\n"+filler+"❯", false)
+	if _, attempt, ok := tr.observe(conditions, filler+errorPane, true); !ok || attempt != 1 {
+		t.Errorf("after progress: got (%d, %v), want attempt 1", attempt, ok)
+	}
+
+	t.Run("ignores errors above the bottom of the pane", func(t *testing.T) {
+		var tr conditionTracker
+		pane := "$ grep -r rate_limit_error logs/\nAPI Error: 500 Internal server error\n" + filler + "❯"
+		if m, _, ok := tr.observe(conditions, pane, true); ok {
+			t.Errorf("acted on %q in agent output", m.Line)
+		}
+	})
+}
+
+func TestLoadPaneConditions(t *testing.T) {
+	t.Run("config entries extend the table", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "conditions.json")
+		writeTestFile(path, `[{"name": "proxy", "kind": "api-error", "match": "502 Bad Gateway"}]`)
+		conditions, err := loadPaneConditions(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := classifyPane(conditions, "upstream: 502 Bad Gateway"); len(got) != 1 || got[0].Condition.Name != "proxy" {
+			t.Errorf("expected custom condition to match, got %+v", got)
+		}
+	})
+
+	t.Run("rejects unknown kind", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "conditions.json")
+		writeTestFile(path, `[{"name": "x", "kind": "panic", "match": "x"}]`)
+		if _, err := loadPaneConditions(path); err == nil {
+			t.Error("expected error for unknown kind")
+		}
+	})
+}
+
+func TestParseResetTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	now := time.Date(2026, 3, 10, 13, 20, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		line string
+		want time.Time
+		ok   bool
+	}{
+		{"pm today", "resets 3pm", time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC), true},
+		{"am tomorrow", "limit will reset at 9am", time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC), true},
+		{"24h clock with minutes", "resets 13:45", time.Date(2026, 3, 10, 13, 45, 0, 0, time.UTC), true},
+		{"12am is midnight", "resets 12am", time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), true},
+		{"with timezone", "resets 3pm (Europe/Berlin)", time.Date(2026, 3, 10, 15, 0, 0, 0, berlin), true},
+		{"legacy epoch", "Claude AI usage limit reached|1773158400", time.Unix(1773158400, 0), true},
+		{"no time", "usage limit reached", time.Time{}, false},
+		{"invalid hour", "resets 27:00", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseResetTime(tt.line, now)
+			if ok != tt.ok {
+				t.Fatalf("parseResetTime(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("parseResetTime(%q) = %s, want %s", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionWait(t *testing.T) {
+	now := time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC)
+	rate := &paneCondition{Kind: conditionRateLimit}
+	api := &paneCondition{Kind: conditionAPIError}
+
+	t.Run("rate limit waits until reset plus margin", func(t *testing.T) {
+		got := conditionWait(conditionMatch{rate, "resets 3pm"}, 1, now)
+		if want := 2*time.Hour + rateLimitMargin; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("rate limit without reset time uses fallback", func(t *testing.T) {
+		if got := conditionWait(conditionMatch{rate, "usage limit reached"}, 1, now); got != rateLimitFallbackWait {
+			t.Errorf("got %s, want %s", got, rateLimitFallbackWait)
+		}
+	})
+
+	t.Run("api errors back off exponentially up to the cap", func(t *testing.T) {
+		want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, apiErrorMaxWait, apiErrorMaxWait}
+		for i, w := range want {
+			if got := conditionWait(conditionMatch{api, "API Error: 529"}, i+1, now); got != w {
+				t.Errorf("attempt %d: got %s, want %s", i+1, got, w)
+			}
+		}
+	})
+}
@@ -32,8 +32,13 @@ func errMsg(format string, a ...any) {
 	fmt.Printf("%s%s✗%s %s\n", colorRed, colorBold, colorReset, msg)
 }
 
-func printSessionHeader(session, maxSessions int) {
-	fmt.Printf("\n%s%s── Session %d / %d ──%s\n", colorBold, colorBlue, session, maxSessions, colorReset)
+// printSessionHeader prints the session banner; progress (e.g. "milestones
+// 7/12") is appended when set.
+func printSessionHeader(session, maxSessions int, progress string) {
+	if progress != "" {
+		progress = " · " + progress
+	}
+	fmt.Printf("\n%s%s── Session %d / %d%s ──%s\n", colorBold, colorBlue, session, maxSessions, progress, colorReset)
 }
 
 func printFinishBanner(sessions int, lines ...string) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 )
 
@@ -21,21 +22,65 @@ type Config struct {
 	WarnTokens     int
 	CriticalTokens int
 	SessionTimeout int
+	IdleTimeout    int
+	IdlePolicy     string
+	IdleNudge      string
+	Checkpoint     bool
+	PromptBudget   int
+	Workdir        string
+	HandoffKey     string // tmux key bound to handoff-now; "" binds none
+	NoHooks        bool   // leave the context-guard hook out of the run settings
 }
 
 // claudeBin is the resolved path to the claude CLI binary.
 var claudeBin string
 
+// findClaude resolves the claude CLI to an absolute path, exiting if it
+// cannot be found.
 func findClaude() string {
+	p, _, err := resolveClaude()
+	if err == nil {
+		p, err = exec.LookPath(p)
+	}
+	if err == nil {
+		p, err = filepath.Abs(p)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return p
+}
+
+// resolveClaude finds the claude CLI: CLAUDE_BIN if set, else claude in
+// PATH. source says which.
+func resolveClaude() (path, source string, err error) {
 	if v := os.Getenv("CLAUDE_BIN"); v != "" {
-		return v
+		return v, "CLAUDE_BIN", nil
 	}
 	if p, err := exec.LookPath("claude"); err == nil {
-		return p
+		return p, "PATH", nil
+	}
+	return "", "", fmt.Errorf("'claude' not found in PATH. Set CLAUDE_BIN to override.")
+}
+
+// defaultConfig is the configuration before flags: defaults, overridden
+// by environment variables.
+func defaultConfig() Config {
+	return Config{
+		Model:          os.Getenv("MODEL"),
+		MaxSessions:    envIntOrDefault("MAX_SESSIONS", 0),
+		WarnTokens:     envIntOrDefault("CTX_WARN_TOKENS", 175000),
+		CriticalTokens: envIntOrDefault("CTX_CRITICAL_TOKENS", 190000),
+		PermissionMode: envOrDefault("PERMISSION_MODE", "bypassPermissions"),
+		SessionTimeout: envIntOrDefault("SESSION_TIMEOUT", 0),
+		IdleTimeout:    envIntOrDefault("IDLE_TIMEOUT", 0),
+		IdlePolicy:     envOrDefault("IDLE_POLICY", idlePolicyNudge),
+		IdleNudge:      envOrDefault("ICC_IDLE_NUDGE", defaultIdleNudge),
+		PromptBudget:   envIntOrDefault("ICC_PROMPT_BUDGET", defaultPromptBudget),
+		Workdir:        os.Getenv("ICC_WORKDIR"),
+		HandoffKey:     os.Getenv("ICC_HANDOFF_KEY"),
 	}
-	fmt.Fprintln(os.Stderr, "Error: 'claude' not found in PATH. Set CLAUDE_BIN to override.")
-	os.Exit(1)
-	return ""
 }
 
 func envOrDefault(key, fallback string) string {
@@ -74,6 +119,20 @@ func requireIntArg(args []string, i int, flag string) int {
 
 func printUsage() {
 	fmt.Print(`Usage: icc [OPTIONS] "TASK DESCRIPTION"
+       icc COMMAND [ARGS]
+
+Commands:
+  install [--scope S]      Install the context-guard hook (scope: user, project or local; default user;
+                           --dry-run shows the settings.json diff)
+  install --status         Show which scopes have the hook, and its version
+  uninstall [--scope S]    Remove the context-guard hook (backs up settings.json; --dry-run shows the diff)
+  hook                     Run the context guard (called by claude, see install)
+  doctor [--json]          Check claude, tmux, hooks, settings and thresholds, with a fix for each problem
+  handoff-now RUN          Ask a running TTY run's agent to write its handoff now
+  handoff lint FILE...     Check handoff files against the Q0–Q4 protocol
+  checkpoints RUN          List the checkpoints of a run started with --checkpoint
+  restore RUN SESSION      Restore the working tree to a session's checkpoint
+  prompts render NAME      Print the system, pipe or continuation prompt from the templates
 
 Options:
   -p                       Pipe mode (claude -p, no tmux). Default is TTY mode.
@@ -83,9 +142,19 @@ Options:
   --critical-tokens N      Context deny threshold (default: 190000)
   --permission-mode MODE   Permission mode (default: bypassPermissions) [TTY only]
   --session-timeout N      Per-session timeout in seconds (default: 0 = unlimited) [TTY only]
+  --idle-timeout N         Seconds claude may sit unchanged at its prompt (default: 0 = off) [TTY only]
+  --idle-policy POLICY     On idle: nudge, report or exit (default: nudge) [TTY only]
+  --idle-nudge TEXT        Message sent by the nudge policy [TTY only]
+  --checkpoint             Snapshot the working tree after every session to refs/icc/<run>/s<N>
+  --prompt-budget N        Continuation prompt size limit in tokens (default: 16000, 0 = unlimited)
+  -C, --workdir DIR        Run claude and track changes in DIR (default: current directory)
+  --handoff-key KEY        Bind prefix+KEY in tmux to handoff-now for the run (default: none) [TTY only]
+  --no-hooks               Leave the context-guard hook out of the run settings; in TTY mode icc
+                           warns the agent through the pane instead
   --name NAME              tmux session name (default: icc-<random>) [TTY only]
 
-Environment variables CTX_WARN_TOKENS, CTX_CRITICAL_TOKENS also work.
+Environment variables CTX_WARN_TOKENS, CTX_CRITICAL_TOKENS, IDLE_TIMEOUT, IDLE_POLICY,
+ICC_IDLE_NUDGE, ICC_PROMPT_BUDGET, ICC_WORKDIR and ICC_HANDOFF_KEY also work.
 
 NOTE: icc finds the claude binary via exec.LookPath, which ignores shell aliases
 and functions. If you use a wrapper that injects API keys or provider config,
@@ -108,21 +177,41 @@ Examples:
 }
 
 func main() {
-	cfg := Config{
-		Model:          os.Getenv("MODEL"),
-		MaxSessions:    envIntOrDefault("MAX_SESSIONS", 0),
-		WarnTokens:     envIntOrDefault("CTX_WARN_TOKENS", 175000),
-		CriticalTokens: envIntOrDefault("CTX_CRITICAL_TOKENS", 190000),
-		PermissionMode: envOrDefault("PERMISSION_MODE", "bypassPermissions"),
-		SessionTimeout: envIntOrDefault("SESSION_TIMEOUT", 0),
-	}
+	cfg := defaultConfig()
 
 	args := os.Args[1:]
 
 	// Subcommand dispatch
-	if len(args) > 0 && args[0] == "install" {
-		runInstall()
-		return
+	if len(args) > 0 {
+		switch args[0] {
+		case "install":
+			runInstall(args[1:])
+			return
+		case "uninstall":
+			runUninstall(args[1:])
+			return
+		case "hook":
+			runHook()
+			return
+		case "doctor":
+			runDoctor(args[1:])
+			return
+		case "handoff-now":
+			runHandoffNow(args[1:])
+			return
+		case "handoff":
+			runHandoff(args[1:])
+			return
+		case "prompts":
+			runPrompts(args[1:])
+			return
+		case "checkpoints":
+			runCheckpoints(args[1:])
+			return
+		case "restore":
+			runRestore(args[1:])
+			return
+		}
 	}
 
 	for i := 0; i < len(args); {
@@ -148,6 +237,30 @@ func main() {
 		case "--session-timeout":
 			cfg.SessionTimeout = requireIntArg(args, i, "--session-timeout")
 			i += 2
+		case "--idle-timeout":
+			cfg.IdleTimeout = requireIntArg(args, i, "--idle-timeout")
+			i += 2
+		case "--idle-policy":
+			cfg.IdlePolicy = requireArg(args, i, "--idle-policy")
+			i += 2
+		case "--idle-nudge":
+			cfg.IdleNudge = requireArg(args, i, "--idle-nudge")
+			i += 2
+		case "--checkpoint":
+			cfg.Checkpoint = true
+			i++
+		case "--prompt-budget":
+			cfg.PromptBudget = requireIntArg(args, i, "--prompt-budget")
+			i += 2
+		case "-C", "--workdir":
+			cfg.Workdir = requireArg(args, i, args[i])
+			i += 2
+		case "--handoff-key":
+			cfg.HandoffKey = requireArg(args, i, "--handoff-key")
+			i += 2
+		case "--no-hooks":
+			cfg.NoHooks = true
+			i++
 		case "--name":
 			cfg.SessionName = requireArg(args, i, "--name")
 			i += 2
@@ -172,13 +285,40 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Prevent nesting detection
-	os.Unsetenv("CLAUDECODE")
+	if cfg.SessionName != "" {
+		if err := checkRunID(cfg.SessionName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --name: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Resolve claude binary
+	if !validIdlePolicy(cfg.IdlePolicy) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --idle-policy value: %s (want nudge, report or exit)\n", cfg.IdlePolicy)
+		os.Exit(1)
+	}
+
+	// Resolve claude before entering the work dir, so that a relative
+	// CLAUDE_BIN or PATH entry means what it meant where icc was started.
 	claudeBin = findClaude()
 
-	// Export token thresholds for context-guard.sh hook
+	// Everything from here on, claude included, runs in the work dir.
+	if cfg.Workdir != "" {
+		if err := os.Chdir(cfg.Workdir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --workdir: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	workdir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot determine working directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Setenv("ICC_WORKDIR", workdir)
+
+	// Prevent nesting detection
+	os.Unsetenv("CLAUDECODE")
+
+	// Export token thresholds for the context-guard hook
 	os.Setenv("CTX_WARN_TOKENS", strconv.Itoa(cfg.WarnTokens))
 	os.Setenv("CTX_CRITICAL_TOKENS", strconv.Itoa(cfg.CriticalTokens))
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -75,3 +76,23 @@ func TestRequireArg(t *testing.T) {
 		}
 	})
 }
+
+func TestFindClaudeAbsolute(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "claude"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("CLAUDE_BIN", "./claude")
+	want, _ := filepath.EvalSymlinks(filepath.Join(dir, "claude"))
+	got, _ := filepath.EvalSymlinks(findClaude())
+	if got != want {
+		t.Errorf("findClaude = %q, want %q", got, want)
+	}
+	if !filepath.IsAbs(findClaude()) {
+		t.Error("findClaude returned a relative path")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import "fmt"
+
+// OutcomeKind classifies how a session ended.
+type OutcomeKind int
+
+const (
+	OutcomeHandoff     OutcomeKind = iota // the agent wrote a handoff
+	OutcomeCompleted                      // claude exited cleanly, or the agent reported the task complete
+	OutcomeCrashed                        // claude exited with an error or was killed
+	OutcomeTimedOut                       // --session-timeout elapsed
+	OutcomeIdle                           // the agent sat at its prompt and the idle policy gave up
+	OutcomeRateLimited                    // a usage limit or API error ended the session
+	OutcomeAborted                        // the user interrupted icc
+)
+
+var outcomeNames = [...]string{
+	OutcomeHandoff:     "handoff",
+	OutcomeCompleted:   "completed",
+	OutcomeCrashed:     "crashed",
+	OutcomeTimedOut:    "timed-out",
+	OutcomeIdle:        "idle",
+	OutcomeRateLimited: "rate-limited",
+	OutcomeAborted:     "aborted",
+}
+
+func (k OutcomeKind) String() string {
+	if int(k) < len(outcomeNames) {
+		return outcomeNames[k]
+	}
+	return fmt.Sprintf("outcome(%d)", int(k))
+}
+
+// SessionOutcome is how a session ended, why, and what showed it.
+type SessionOutcome struct {
+	Kind     OutcomeKind
+	Reason   string // one line for the log, e.g. "exited with status 1"
+	Evidence string // supporting detail, e.g. the pane tail at a crash
+	ExitCode *int   // claude's exit status, when known
+	Status   string // the handoff's front-matter status, if it had one
+}
+
+// RelayAction is what the supervisor does after a session.
+type RelayAction int
+
+const (
+	ActionRelay RelayAction = iota // start the next session from the handoff
+	ActionRetry                    // start a recovery session without a handoff
+	ActionStop                     // end the run
+)
+
+// RelayState is the part of the run state the transition depends on.
+type RelayState struct {
+	Session     int // the session that just ended
+	MaxSessions int // 0 = unlimited
+	Crashes     int // consecutive crashed sessions, including this one
+	Blocked     int // consecutive handoffs with status "blocked", including this one
+	OpenPlan    int // open milestones in the task plan
+	PlanBlocks  int // completions already refused in a row because of open milestones
+}
+
+// RelayDecision is the result of decideNext.
+type RelayDecision struct {
+	Action RelayAction
+	Reason string
+}
+
+// decideNext is the relay state machine: given how a session ended, it
+// decides whether to relay, retry or stop. Both modes use it so that the
+// policy lives in one place and can be tested without tmux.
+func decideNext(o SessionOutcome, st RelayState) RelayDecision {
+	var d RelayDecision
+	switch o.Kind {
+	case OutcomeAborted:
+		return RelayDecision{ActionStop, "aborted by user"}
+	case OutcomeCompleted:
+		if planBlocksCompletion(st) {
+			d = RelayDecision{ActionRetry, fmt.Sprintf("the plan has %d open milestones", st.OpenPlan)}
+			break
+		}
+		return RelayDecision{ActionStop, "task complete"}
+	case OutcomeTimedOut:
+		return RelayDecision{ActionStop, "timed out without a handoff"}
+	case OutcomeCrashed:
+		if st.Crashes >= maxConsecutiveCrashes {
+			return RelayDecision{ActionStop, fmt.Sprintf("%d consecutive sessions crashed", st.Crashes)}
+		}
+		d = RelayDecision{ActionRetry, "recovering from a crash"}
+	case OutcomeIdle:
+		d = RelayDecision{ActionRetry, "recovering from an idle session"}
+	case OutcomeRateLimited:
+		d = RelayDecision{ActionRetry, "retrying after a usage limit or API error"}
+	case OutcomeHandoff:
+		if o.Status == statusBelievedDone {
+			if planBlocksCompletion(st) {
+				d = RelayDecision{ActionRelay, fmt.Sprintf("the plan has %d open milestones", st.OpenPlan)}
+				break
+			}
+			return RelayDecision{ActionStop, "the agent believes the task is done"}
+		}
+		if o.Status == statusBlocked && st.Blocked >= maxBlockedSessions {
+			return RelayDecision{ActionStop, fmt.Sprintf("blocked in %d consecutive sessions", st.Blocked)}
+		}
+		d = RelayDecision{ActionRelay, "relaying the handoff"}
+	default:
+		d = RelayDecision{ActionRelay, "relaying the handoff"}
+	}
+
+	if st.MaxSessions > 0 && st.Session >= st.MaxSessions {
+		return RelayDecision{ActionStop, fmt.Sprintf("reached max sessions (%d)", st.MaxSessions)}
+	}
+	return d
+}
+
+// planBlocksCompletion reports whether open milestones keep a completed
+// session from ending the run. After maxPlanBlocks refusals in a row the
+// agent's judgment wins.
+func planBlocksCompletion(st RelayState) bool {
+	return st.OpenPlan > 0 && st.PlanBlocks < maxPlanBlocks
+}
+
+// isCompletion reports whether the session claims the task is done.
+func isCompletion(o SessionOutcome) bool {
+	return o.Kind == OutcomeCompleted || o.Status == statusBelievedDone
+}
+
+// recoveryNote stands in for a handoff in the session that follows a
+// retried outcome.
+func recoveryNote(o SessionOutcome, session int, transcript string) string {
+	switch o.Kind {
+	case OutcomeCrashed:
+		return crashRecoveryNote(session, o.Reason, o.Evidence, transcript)
+	case OutcomeIdle:
+		return idleRecoveryNote(session)
+	case OutcomeCompleted:
+		return fmt.Sprintf("(No handoff was written. Session %d ended (%s) as if the task were complete, but the task plan still has open milestones. Check the plan below against the repository, then finish the open milestones or mark them `- [-] milestone — reason`.)",
+			session, o.Reason)
+	default:
+		return fmt.Sprintf("(No handoff was written. Session %d ended: %s. Reorient from the repository state above and continue the task.)",
+			session, o.Reason)
+	}
+}
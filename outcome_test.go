@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutcomeKindString(t *testing.T) {
+	if got := OutcomeRateLimited.String(); got != "rate-limited" {
+		t.Errorf("got %q", got)
+	}
+	if got := OutcomeKind(99).String(); got != "outcome(99)" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDecideNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   OutcomeKind
+		status string
+		st     RelayState
+		want   RelayAction
+	}{
+		{"handoff relays", OutcomeHandoff, "", RelayState{Session: 1}, ActionRelay},
+		{"handoff at max sessions stops", OutcomeHandoff, "", RelayState{Session: 3, MaxSessions: 3}, ActionStop},
+		{"handoff below max relays", OutcomeHandoff, "", RelayState{Session: 2, MaxSessions: 3}, ActionRelay},
+		{"completed stops", OutcomeCompleted, "", RelayState{Session: 1}, ActionStop},
+		{"aborted stops", OutcomeAborted, "", RelayState{Session: 1}, ActionStop},
+		{"timeout without handoff stops", OutcomeTimedOut, "", RelayState{Session: 1}, ActionStop},
+		{"first crash retries", OutcomeCrashed, "", RelayState{Session: 1, Crashes: 1}, ActionRetry},
+		{"repeated crashes stop", OutcomeCrashed, "", RelayState{Session: 4, Crashes: maxConsecutiveCrashes}, ActionStop},
+		{"crash at max sessions stops", OutcomeCrashed, "", RelayState{Session: 2, MaxSessions: 2, Crashes: 1}, ActionStop},
+		{"idle retries", OutcomeIdle, "", RelayState{Session: 1}, ActionRetry},
+		{"rate limit retries", OutcomeRateLimited, "", RelayState{Session: 1}, ActionRetry},
+		{"believed done stops", OutcomeHandoff, statusBelievedDone, RelayState{Session: 1}, ActionStop},
+		{"in progress relays", OutcomeHandoff, statusInProgress, RelayState{Session: 1}, ActionRelay},
+		{"first blocked handoff relays", OutcomeHandoff, statusBlocked, RelayState{Session: 1, Blocked: 1}, ActionRelay},
+		{"repeatedly blocked stops", OutcomeHandoff, statusBlocked, RelayState{Session: 2, Blocked: maxBlockedSessions}, ActionStop},
+		{"completed with open milestones retries", OutcomeCompleted, "", RelayState{Session: 1, OpenPlan: 2}, ActionRetry},
+		{"believed done with open milestones relays", OutcomeHandoff, statusBelievedDone, RelayState{Session: 1, OpenPlan: 2}, ActionRelay},
+		{"open milestones at max sessions stop", OutcomeCompleted, "", RelayState{Session: 3, MaxSessions: 3, OpenPlan: 2}, ActionStop},
+		{"completion accepted after repeated refusals", OutcomeCompleted, "", RelayState{Session: 4, OpenPlan: 2, PlanBlocks: maxPlanBlocks}, ActionStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideNext(SessionOutcome{Kind: tt.kind, Status: tt.status}, tt.st)
+			if got.Action != tt.want {
+				t.Errorf("decideNext(%s, %+v) = %+v, want action %d", tt.kind, tt.st, got, tt.want)
+			}
+			if got.Reason == "" {
+				t.Error("decision should carry a reason")
+			}
+		})
+	}
+}
+
+func TestPipeOutcome(t *testing.T) {
+	conditions, err := loadPaneConditions("/nonexistent/pane-conditions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("handoff ", 50)
+
+	tests := []struct {
+		name        string
+		result      string
+		stats       sessionStats
+		interrupted bool
+		want        OutcomeKind
+	}{
+		{"handoff", long, sessionStats{toolUseCount: 5}, false, OutcomeHandoff},
+		{"brief output completes", "Done.", sessionStats{}, false, OutcomeCompleted},
+		{"crash", "", sessionStats{exitCode: 1, stderrTail: "Error: boom"}, false, OutcomeCrashed},
+		{"empty result after tools", "", sessionStats{toolUseCount: 3}, false, OutcomeCrashed},
+		{"usage limit", "Claude AI usage limit reached|1767268800", sessionStats{exitCode: 1}, false, OutcomeRateLimited},
+		{"overloaded on stderr", "", sessionStats{exitCode: 1, stderrTail: "API Error: 529 overloaded_error"}, false, OutcomeRateLimited},
+		{"interrupted", long, sessionStats{exitCode: 130}, true, OutcomeAborted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, match := pipeOutcome(tt.result, tt.stats, conditions, tt.interrupted)
+			if got.Kind != tt.want {
+				t.Errorf("pipeOutcome kind = %s (%s), want %s", got.Kind, got.Reason, tt.want)
+			}
+			if (got.Kind == OutcomeRateLimited) != (match != nil) {
+				t.Errorf("match should be set exactly for rate-limited outcomes, got %+v", match)
+			}
+			if tt.stats.exitCode != 0 && (got.ExitCode == nil || *got.ExitCode != tt.stats.exitCode) {
+				t.Errorf("exit code not carried: %v", got.ExitCode)
+			}
+		})
+	}
+}
+
+func TestPipeSessionBadClaudePath(t *testing.T) {
+	old := claudeBin
+	claudeBin = filepath.Join(t.TempDir(), "no-such-claude")
+	defer func() { claudeBin = old }()
+
+	result, stats := runPipeSession("", "/nonexistent/settings.json", "task")
+	got, _ := pipeOutcome(result, stats, nil, false)
+	if got.Kind != OutcomeCrashed || !strings.Contains(got.Reason, "did not start") {
+		t.Errorf("pipeOutcome = %s (%s), want a crash", got.Kind, got.Reason)
+	}
+}
+
+func TestRecoveryNote(t *testing.T) {
+	crash := recoveryNote(SessionOutcome{Kind: OutcomeCrashed, Reason: "exited with status 1", Evidence: "auth error"}, 2, "")
+	if !strings.Contains(crash, "crashed") || !strings.Contains(crash, "auth error") {
+		t.Errorf("crash note missing details: %q", crash)
+	}
+	idle := recoveryNote(SessionOutcome{Kind: OutcomeIdle}, 2, "")
+	if !strings.Contains(idle, "input prompt") {
+		t.Errorf("idle note unexpected: %q", idle)
+	}
+	done := recoveryNote(SessionOutcome{Kind: OutcomeCompleted, Reason: "claude exited"}, 3, "")
+	if !strings.Contains(done, "open milestones") {
+		t.Errorf("completion note unexpected: %q", done)
+	}
+}
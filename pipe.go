@@ -3,58 +3,287 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func runPipe(cfg Config) {
 	var totalCost float64
 	var totalInput, totalOutput int
 	sessionCount := 0
+	crashes := 0
+	blocked := 0
+	limitAttempts := 0
 	context := ""
 
+	run, err := newRun("icc-"+randomHex(3), cfg.Task, "pipe")
+	if err != nil {
+		errMsg("Failed to create run directory: %v", err)
+		os.Exit(1)
+	}
+	templates, err := loadPromptTemplates(promptTemplatesDir())
+	if err != nil {
+		errMsg("Failed to load prompt templates: %v", err)
+		os.Exit(1)
+	}
+	conditions, err := loadPaneConditions(paneConditionsPath())
+	if err != nil {
+		errMsg("Failed to load pane conditions: %v", err)
+		os.Exit(1)
+	}
+
+	run.GitBase = takeGitSnapshot()
+	if err := run.save(); err != nil {
+		errMsg("Failed to save run manifest: %v", err)
+	}
+	if cfg.Checkpoint && (run.GitBase == nil || !validCheckpointRef(run.ID)) {
+		errMsg("--checkpoint needs a git repository and a run name usable in a git ref")
+		os.Exit(1)
+	}
+	prevSnapshot := run.GitBase
+	// Outside git, changes are found by comparing file contents.
+	var fileBase *fileSnapshot
+	if run.GitBase == nil {
+		fileBase = takeFileSnapshot(run.Workdir, nil)
+	}
+	prevFiles := fileBase
+	hookInstalled := hookActive(run.Workdir)
+	if !hookInstalled {
+		warnLegacyHook(run.Workdir)
+	}
+	settingsPath, err := writeRunSettings(run, cfg, !cfg.NoHooks && !hookInstalled)
+	if err != nil {
+		errMsg("Failed to write run settings: %v", err)
+		os.Exit(1)
+	}
+	plan := planPath(run.Dir)
+	os.Setenv("ICC_PLAN_PATH", plan)
+	planBlocks := 0
+
+	// claude shares the terminal's process group and receives Ctrl-C itself;
+	// icc only needs to notice it and stop relaying.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+sessionLoop:
 	for i := 1; cfg.MaxSessions == 0 || i <= cfg.MaxSessions; i++ {
 		sessionCount = i
-		printSessionHeader(i, cfg.MaxSessions)
+		printSessionHeader(i, cfg.MaxSessions, loadPlan(plan).progress())
 		if cfg.Model != "" {
 			fmt.Printf("  model: %s\n", cfg.Model)
 		} else {
 			fmt.Printf("  model: (default)\n")
 		}
 
-		var prompt string
-		if i == 1 {
-			prompt = cfg.Task + "\n\n" + pipeSystemPrompt()
-		} else {
-			prompt = buildContinuationPrompt(i, cfg.Task, context) + "\n\n" + pipeSystemPrompt()
+		snapshot := run.GitBase
+		if i > 1 {
+			snapshot = takeGitSnapshot()
 		}
+		files := fileBase
+		if i > 1 && fileBase != nil {
+			files = takeFileSnapshot(run.Workdir, prevFiles)
+		}
+		data := newPromptData(i, cfg.MaxSessions, cfg.Task)
+		data.setPlan(plan)
+		prompt := cfg.Task
+		var err error
+		if context != "" {
+			data.setGitState(run.GitBase, prevSnapshot, snapshot)
+			data.setFileState(fileBase, prevFiles, files)
+			data.setLedger(run, i-1)
+			data.setBudget(cfg.PromptBudget, run.Dir)
+			var cut []string
+			if prompt, cut, err = buildContinuationPrompt(templates, data, context); len(cut) > 0 {
+				logMsg("Cut to fit the prompt budget: %s (full text in %s)", strings.Join(cut, ", "), run.Dir)
+			}
+		}
+		sysprompt, sysErr := pipeSystemPrompt(templates, data)
+		if err != nil || sysErr != nil {
+			errMsg("Failed to render prompt: %v", errors.Join(err, sysErr))
+			os.Exit(1)
+		}
+		prompt += "\n\n" + sysprompt
 
-		result, stats := runPipeSession(cfg.Model, prompt)
+		sessionStart := time.Now()
+		result, stats := runPipeSession(cfg.Model, settingsPath, prompt)
 
 		totalCost += stats.cost
 		totalInput += stats.inputTokens
 		totalOutput += stats.outputTokens
 
-		okMsg("Session %d done — tools: %d  cost: $%.4f  tokens: %d/%d",
-			i, stats.toolUseCount, stats.cost, stats.inputTokens, stats.outputTokens)
+		interrupted := false
+		select {
+		case <-interrupt:
+			interrupted = true
+		default:
+		}
+		outcome, match := pipeOutcome(result, stats, conditions, interrupted)
 
-		context = result
+		if outcome.Kind == OutcomeCrashed {
+			crashes++
+		} else {
+			crashes = 0
+		}
+		rec := sessionRecord{
+			Number:    i,
+			StartedAt: sessionStart,
+			EndedAt:   time.Now(),
+			Outcome:   outcome.Kind.String(),
+			Reason:    outcome.Reason,
+			Evidence:  outcome.Evidence,
+			ExitCode:  outcome.ExitCode,
+			GitStart:  snapshot,
+		}
+		taskPlan := loadPlan(plan)
+		rec.Milestones = taskPlan.progress()
+		if outcome.Kind == OutcomeHandoff {
+			rec.Handoff = parseHandoff(result)
+		}
+		if cfg.Checkpoint {
+			rec.Checkpoint = checkpointSession(run, rec)
+		}
+		run.recordSession(rec)
+		if err := writeLedger(run); err != nil {
+			errMsg("Failed to write the ledger: %v", err)
+		}
+		outcome.Status = rec.Handoff.status()
+		if outcome.Status == statusBlocked {
+			blocked++
+		} else {
+			blocked = 0
+		}
 
-		if stats.toolUseCount == 0 && len(result) < 200 {
-			fmt.Printf("\n%s%s✓ Task appears complete (session used no tools and output was brief)%s\n",
-				colorGreen, colorBold, colorReset)
-			break
+		switch outcome.Kind {
+		case OutcomeHandoff, OutcomeCompleted:
+			okMsg("Session %d done — tools: %d  cost: $%.4f  tokens: %d/%d",
+				i, stats.toolUseCount, stats.cost, stats.inputTokens, stats.outputTokens)
+			if rec.Handoff != nil {
+				logHandoffSummary(rec.Handoff)
+			}
+		case OutcomeCrashed:
+			errMsg("Session %d: claude crashed (%s)", i, outcome.Reason)
+		default:
+			errMsg("Session %d: %s (%s)", i, outcome.Kind, outcome.Reason)
 		}
-		if result == "" {
-			errMsg("Session returned empty result, stopping")
+
+		decision := decideNext(outcome, RelayState{
+			Session:     i,
+			MaxSessions: cfg.MaxSessions,
+			Crashes:     crashes,
+			Blocked:     blocked,
+			OpenPlan:    taskPlan.open(),
+			PlanBlocks:  planBlocks,
+		})
+		if isCompletion(outcome) && decision.Action != ActionStop {
+			planBlocks++
+			logMsg("Not complete yet: %s", decision.Reason)
+		} else {
+			planBlocks = 0
+		}
+		if decision.Action == ActionStop {
+			if outcome.Status == statusBelievedDone {
+				outcome.Reason = decision.Reason
+			}
+			if outcome.Kind == OutcomeCompleted || outcome.Status == statusBelievedDone {
+				fmt.Printf("\n%s%s✓ Task appears complete (%s)%s\n",
+					colorGreen, colorBold, outcome.Reason, colorReset)
+			} else {
+				logMsg("Stopping: %s", decision.Reason)
+			}
 			break
 		}
+
+		switch {
+		case outcome.Kind == OutcomeRateLimited:
+			limitAttempts++
+			now := time.Now()
+			wait := conditionWait(*match, limitAttempts, now)
+			logMsg("Pausing until %s before retrying...", now.Add(wait).Format("15:04:05"))
+			interrupted := sleepInterrupted(wait, interrupt)
+			action := fmt.Sprintf("paused %s, then retried the session", wait.Round(time.Second))
+			if interrupted {
+				action = fmt.Sprintf("paused %s of %s, then interrupted", time.Since(now).Round(time.Second), wait.Round(time.Second))
+			}
+			run.recordIncident(incident{
+				Time:    now,
+				Session: i,
+				Kind:    match.Condition.Kind,
+				Detail:  match.Line,
+				Action:  action,
+			})
+			if interrupted {
+				logMsg("Interrupted while paused, stopping")
+				break sessionLoop
+			}
+		case decision.Action == ActionRetry:
+			logMsg("Starting a recovery session (%s)...", decision.Reason)
+			context = recoveryNote(outcome, i, formatTranscriptTail(stats.lastMessages, 1500))
+		default:
+			limitAttempts = 0
+			context = result
+		}
+		prevSnapshot = snapshot
+		prevFiles = files
 	}
 
-	printFinishBanner(sessionCount,
+	banner := []string{
 		fmt.Sprintf("Total cost: $%.4f", totalCost),
 		fmt.Sprintf("Total tokens: %d in / %d out", totalInput, totalOutput),
-	)
+		fmt.Sprintf("Run history: %s", filepath.Join(run.Dir, "manifest.json")),
+	}
+	if history := run.statusHistory(); history != "" {
+		banner = append(banner, "Status: "+history)
+	}
+	if progress := loadPlan(plan).progress(); progress != "" {
+		banner = append(banner, "Plan: "+progress)
+	}
+	printFinishBanner(sessionCount, banner...)
+}
+
+// pipeOutcome classifies a finished pipe-mode session. The returned match
+// is set for OutcomeRateLimited.
+func pipeOutcome(result string, stats sessionStats, conditions []paneCondition, interrupted bool) (SessionOutcome, *conditionMatch) {
+	o := SessionOutcome{}
+	if stats.exitCode != 0 {
+		code := stats.exitCode
+		o.ExitCode = &code
+	}
+	brief := stats.toolUseCount == 0 && len(result) < 200
+
+	if interrupted {
+		o.Kind, o.Reason = OutcomeAborted, "interrupted"
+		return o, nil
+	}
+	if stats.startErr != nil {
+		o.Kind, o.Reason = OutcomeCrashed, fmt.Sprintf("claude did not start: %v", stats.startErr)
+		return o, nil
+	}
+	if stats.exitCode != 0 || brief {
+		if matches := classifyPane(conditions, result+"\n"+stats.stderrTail); len(matches) > 0 {
+			m := matches[len(matches)-1]
+			o.Kind, o.Reason, o.Evidence = OutcomeRateLimited, m.Condition.Kind, m.Line
+			return o, &m
+		}
+	}
+	switch {
+	case stats.exitCode != 0:
+		o.Kind, o.Reason, o.Evidence = OutcomeCrashed, describeExit(stats.exitCode), stats.stderrTail
+	case brief:
+		o.Kind, o.Reason = OutcomeCompleted, "session used no tools and output was brief"
+	case result == "":
+		o.Kind, o.Reason = OutcomeCrashed, "session returned an empty result"
+	default:
+		o.Kind, o.Reason = OutcomeHandoff, "session output used as handoff"
+	}
+	return o, nil
 }
 
 type sessionStats struct {
@@ -62,25 +291,31 @@ type sessionStats struct {
 	cost         float64
 	inputTokens  int
 	outputTokens int
+	exitCode     int
+	stderrTail   string
+	lastMessages []transcriptMessage // last assistant texts, for crash recovery
+	startErr     error               // claude could not be started
 }
 
-func runPipeSession(model, prompt string) (string, sessionStats) {
-	args := []string{"-p"}
+func runPipeSession(model, settingsPath, prompt string) (string, sessionStats) {
+	args := []string{"-p", "--settings", settingsPath}
 	if model != "" {
 		args = append(args, "--model", model)
 	}
 	args = append(args, "--verbose", "--output-format", "stream-json", prompt)
 	cmd := exec.Command(claudeBin, args...)
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = stderr
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		errMsg("Failed to create pipe: %v", err)
-		return "", sessionStats{}
+		return "", sessionStats{exitCode: -1, startErr: err}
 	}
 
 	if err := cmd.Start(); err != nil {
 		errMsg("Failed to start claude: %v", err)
-		return "", sessionStats{}
+		return "", sessionStats{exitCode: -1, startErr: err}
 	}
 
 	var result string
@@ -111,6 +346,10 @@ func runPipeSession(model, prompt string) (string, sessionStats) {
 							if b["type"] == "text" {
 								if text, ok := b["text"].(string); ok && text != "" {
 									fmt.Printf("%s%s%s\n", colorCyan, text, colorReset)
+									stats.lastMessages = append(stats.lastMessages, transcriptMessage{Role: "assistant", Text: text})
+									if len(stats.lastMessages) > 8 {
+										stats.lastMessages = stats.lastMessages[1:]
+									}
 								}
 							}
 						}
@@ -144,6 +383,15 @@ func runPipeSession(model, prompt string) (string, sessionStats) {
 		}
 	}
 
-	cmd.Wait()
+	if err := cmd.Wait(); err != nil {
+		stats.exitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stats.exitCode = exitErr.ExitCode()
+			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				stats.exitCode = 128 + int(ws.Signal())
+			}
+		}
+	}
+	stats.stderrTail = stderr.String()
 	return result, stats
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// planFile is the milestone checklist in the run directory, exposed to
+// claude as ICC_PLAN_PATH.
+const planFile = "plan.md"
+
+// maxPlanBlocks is how many times in a row a completion may be refused
+// because of open milestones before icc accepts it anyway.
+const maxPlanBlocks = 2
+
+// Milestone states, from the checkbox: "[ ]", "[x]" and "[-]".
+const (
+	milestoneOpen    = "open"
+	milestoneDone    = "done"
+	milestoneSkipped = "skipped"
+)
+
+var (
+	milestoneRe = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX-])\]\s+(.*)$`)
+	// skipReasonRe separates a skipped milestone from its reason:
+	// "- [-] Add caching — not needed below 1k rps".
+	skipReasonRe = regexp.MustCompile(`\s+(?:—|--|-|:)\s+`)
+)
+
+// milestone is one checklist item of the plan.
+type milestone struct {
+	Text   string
+	State  string
+	Reason string // why a skipped milestone was dropped
+}
+
+// taskPlan is the parsed checklist.
+type taskPlan struct {
+	Milestones []milestone
+}
+
+func planPath(runDir string) string {
+	return filepath.Join(runDir, planFile)
+}
+
+// parsePlan reads the checklist items of a plan; other lines are ignored.
+func parsePlan(text string) taskPlan {
+	var p taskPlan
+	for _, line := range splitLines(text) {
+		m := milestoneRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ms := milestone{Text: strings.TrimSpace(m[2]), State: milestoneOpen}
+		switch m[1] {
+		case "x", "X":
+			ms.State = milestoneDone
+		case "-":
+			ms.State = milestoneSkipped
+			if parts := skipReasonRe.Split(ms.Text, 2); len(parts) == 2 {
+				ms.Text, ms.Reason = parts[0], strings.TrimSpace(parts[1])
+			}
+		}
+		p.Milestones = append(p.Milestones, ms)
+	}
+	return p
+}
+
+// loadPlan parses the plan file; a missing file is an empty plan.
+func loadPlan(path string) taskPlan {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return taskPlan{}
+	}
+	return parsePlan(string(data))
+}
+
+func (p taskPlan) count(state string) int {
+	n := 0
+	for _, m := range p.Milestones {
+		if m.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// open counts the milestones that keep the task from being complete:
+// unchecked ones and ones skipped without a reason.
+func (p taskPlan) open() int {
+	n := p.count(milestoneOpen)
+	for _, m := range p.Milestones {
+		if m.State == milestoneSkipped && m.Reason == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// progress is e.g. "milestones 7/12" or "milestones 7/12, 1 skipped",
+// or "" without a plan.
+func (p taskPlan) progress() string {
+	if len(p.Milestones) == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("milestones %d/%d", p.count(milestoneDone), len(p.Milestones))
+	if n := p.count(milestoneSkipped); n > 0 {
+		s += fmt.Sprintf(", %d skipped", n)
+	}
+	return s
+}
+
+// setPlan fills the plan fields of a prompt.
+func (d *promptData) setPlan(path string) {
+	d.PlanPath = path
+	if data, err := os.ReadFile(path); err == nil {
+		d.Plan = strings.TrimSpace(string(data))
+		d.PlanOpen = parsePlan(d.Plan).open()
+	}
+}
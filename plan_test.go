@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPlan = `# Plan
+
+Some notes the agent keeps.
+
+- [x] Set up the HTTP server
+- [X] Add the /users endpoint
+* [ ] Add authentication
+- [-] Add caching — not needed below 1k rps
+- [-] Add metrics
+- [ ]not a milestone (no space)
+`
+
+func TestParsePlan(t *testing.T) {
+	p := parsePlan(testPlan)
+	if len(p.Milestones) != 5 {
+		t.Fatalf("got %d milestones, want 5: %+v", len(p.Milestones), p.Milestones)
+	}
+	if p.Milestones[2].State != milestoneOpen || p.Milestones[2].Text != "Add authentication" {
+		t.Errorf("milestone 3 = %+v", p.Milestones[2])
+	}
+	if m := p.Milestones[3]; m.State != milestoneSkipped || m.Text != "Add caching" || m.Reason != "not needed below 1k rps" {
+		t.Errorf("skipped milestone = %+v", m)
+	}
+	if got := p.open(); got != 2 {
+		t.Errorf("open() = %d, want 2 (one unchecked, one skipped without reason)", got)
+	}
+	if got := p.progress(); got != "milestones 2/5, 2 skipped" {
+		t.Errorf("progress() = %q", got)
+	}
+	if got := (taskPlan{}).progress(); got != "" {
+		t.Errorf("empty plan progress = %q", got)
+	}
+}
+
+func TestSetPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), planFile)
+
+	d := newPromptData(2, 0, "task")
+	d.setPlan(path)
+	if d.PlanPath != path || d.Plan != "" {
+		t.Errorf("before the plan exists: %+v", d)
+	}
+
+	writeTestFile(path, testPlan)
+	d.setPlan(path)
+	if !strings.Contains(d.Plan, "Add authentication") || d.PlanOpen != 2 {
+		t.Errorf("setPlan: Plan = %q, PlanOpen = %d", d.Plan, d.PlanOpen)
+	}
+
+	got, _, err := buildContinuationPrompt(testTemplates(t), d, "handoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "[ ] Add authentication") || !strings.Contains(got, "2 milestone(s) still open") {
+		t.Errorf("continuation prompt should include the plan:\n%s", got)
+	}
+}
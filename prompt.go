@@ -1,133 +1,289 @@
 package main
 
 import (
+	"bytes"
+	"embed"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
+	"text/template"
 )
 
-const handoffFormat = `## Q0: What is the current state of this project?
-(what is this project, what is the current goal, how far have we progressed.
-The next agent is a blank process with ZERO history — this section is its only orientation.)
-
-## Q1: What should the next agent do first?
-(Be specific: which file, which function, what exact change.
-NOT "continue implementing X" — that is useless without context.)
-
-## Q2: What will NOT work? What dead ends were discovered?
-(Every dead end you hide costs the next agent 10+ tool calls to rediscover.)
-
-## Q3: What non-obvious decisions were made and why?
-(If the next agent reads the code and thinks "why not do it the other way?" — answer here.)
-
-## Q4: What are you uncertain about?
-(Honest uncertainty is more valuable than false confidence.)`
-
-const handoffRules = `- You are an AUTONOMOUS agent. NEVER ask the human for confirmation, clarification, or approval. NEVER pause to wait for input. Make decisions and execute.
-- DO NOT list completed work or modified files — the supervisor auto-injects git diff.
-- DO NOT restate the original task — the supervisor passes it separately.
-- DO NOT answer a question with "None" — if truly none, skip it entirely.
-- Q0 (project state) is MANDATORY — without it the next agent cannot orient itself.`
+// defaultTemplates holds the built-in prompts. A project overrides any of
+// them, by file name, from promptTemplatesDir().
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Top-level prompt templates. handoff-format.tmpl and handoff-rules.tmpl
+// are partials included by the system prompts.
+const (
+	promptSystem       = "system.tmpl"
+	promptPipeSystem   = "pipe-system.tmpl"
+	promptContinuation = "continuation.tmpl"
+)
 
-// renderSystemPrompt builds the TTY mode system prompt (includes handoff file path).
-func renderSystemPrompt(handoffPath string) string {
-	return fmt.Sprintf(`[IMPORTANT SYSTEM INSTRUCTION — ICC RELAY PROTOCOL]
+var promptNames = map[string]string{
+	"system":       promptSystem,
+	"pipe":         promptPipeSystem,
+	"continuation": promptContinuation,
+}
 
-You are one node in an autonomous state machine. When your context fills up, a supervisor will restart a fresh agent that inherits your state. Your job is to make progress on the task and, when warned about context limits, write a handoff file so the next agent can resume without loss.
+// promptData is what the prompt templates can use.
+type promptData struct {
+	Session           int    // the session being started, from 1
+	PrevSession       int    // Session-1
+	Task              string // the original task
+	HandoffPath       string // where this session writes its handoff (TTY mode)
+	PlanPath          string // the run's milestone checklist (ICC_PLAN_PATH)
+	Plan              string // its current content, "" before it is written
+	PlanOpen          int    // milestones still open
+	MaxSessions       int    // 0 = unlimited
+	RemainingSessions int    // sessions that may follow this one, -1 = unlimited
+
+	// Set for the continuation prompt only.
+	PreviousHandoff string              // the previous handoff's answered sections, or a recovery note
+	FrontMatter     *handoffFrontMatter // the previous handoff's front-matter, if it had one
+	HandoffSource   string              // its file path, or "(inline text)"
+	GitRepo         bool                // the work dir is a git repository; the fields below are set
+	FileState       bool                // it is not, and SessionDiff and RunDiff list changed files instead
+	SessionDiff     string              // diff stat of the changes made by the previous session
+	RunDiff         string              // diff stat of the changes since the run started
+	RunCommits      string              // commits made since the run started, newest first
+	GitStatus       string              // git status --short
+	Ledger          string              // dead ends and decisions from handoffs before the previous one
+	LedgerPath      string              // the full ledger in the run directory
+
+	budget promptBudget // size limit of the continuation prompt, see setBudget
+}
 
-## Handoff Mechanism
+func newPromptData(session, maxSessions int, task string) promptData {
+	d := promptData{
+		Session:           session,
+		PrevSession:       session - 1,
+		Task:              task,
+		MaxSessions:       maxSessions,
+		RemainingSessions: -1,
+	}
+	if maxSessions > 0 {
+		d.RemainingSessions = max(maxSessions-session, 0)
+	}
+	return d
+}
 
-The environment variable ICC_HANDOFF_PATH is set to:
-  %s
-This is the WRITE target — you write your handoff file here. It is NOT the previous session's handoff path.
+// promptFuncs are the functions available to templates besides the
+// text/template builtins.
+var promptFuncs = template.FuncMap{
+	"join": strings.Join,
+}
 
-When you receive a context warning (⚠ Context used...), you MUST:
-1. Finish your current immediate step
-2. Use the Write tool to create the handoff file at the EXACT path above
-3. The file signals the supervisor to start a new session — this is how the relay works
+func promptTemplatesDir() string {
+	return envOrDefault("ICC_TEMPLATES", filepath.Join(".icc", "templates"))
+}
 
-## Handoff File Format
+// loadPromptTemplates parses the built-in templates, then every *.tmpl in
+// dir on top, replacing the built-in template of the same name. A missing
+// dir is not an error. Each top-level prompt is rendered once with sample
+// data so that a broken override fails at startup rather than mid-run.
+func loadPromptTemplates(dir string) (*template.Template, error) {
+	t := template.New("").Funcs(promptFuncs)
+	if err := parseTemplates(t, defaultTemplates, "templates/*.tmpl"); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		if err := parseTemplates(t, os.DirFS(dir), "*.tmpl"); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
 
-The file MUST follow this structure:
+	sample := newPromptData(2, 5, "sample task")
+	sample.HandoffPath = "/tmp/icc-handoff-sample.md"
+	sample.PlanPath, sample.Plan, sample.PlanOpen = filepath.Join(runsDir(), "sample", "plan.md"), "- [ ] sample", 1
+	sample.Ledger, sample.LedgerPath = "- [s1] sample", filepath.Join(runsDir(), "sample", "ledger.md")
+	sample.FrontMatter = &handoffFrontMatter{Status: statusInProgress, NextSteps: []string{"step"}, FilesTouched: []string{"file"}, Tests: testsFailing, FailingTests: []string{"test"}, Risks: []string{"risk"}}
+	for _, name := range []string{promptSystem, promptPipeSystem, promptContinuation} {
+		if _, err := executePrompt(t, name, sample); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
 
-`+"```"+`markdown
-%s
-`+"```"+`
+// parseTemplates adds the files matching pattern in fsys to t, each named
+// by its base name. One trailing newline is dropped so that partials can
+// be included inline and files can end the way editors save them.
+func parseTemplates(t *template.Template, fsys fs.FS, pattern string) error {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		text := strings.TrimSuffix(string(data), "\n")
+		if _, err := t.New(path.Base(file)).Parse(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-## Critical Rules
+func executePrompt(t *template.Template, name string, d promptData) (string, error) {
+	var b bytes.Buffer
+	if err := t.ExecuteTemplate(&b, name, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
 
-%s
-- The handoff is a FILE written via the Write tool — NOT text output to the conversation.`, handoffPath, handoffFormat, handoffRules)
+// renderSystemPrompt builds the TTY mode system prompt (includes handoff file path).
+func renderSystemPrompt(t *template.Template, d promptData) (string, error) {
+	return executePrompt(t, promptSystem, d)
 }
 
 // pipeSystemPrompt returns the pipe mode system prompt (no file signals).
-func pipeSystemPrompt() string {
-	return fmt.Sprintf(`[IMPORTANT SYSTEM INSTRUCTION — ICC RELAY PROTOCOL]
-
-You are one node in an autonomous state machine. When your context fills up, a supervisor will restart a fresh agent that inherits your state.
-
-When you receive a context warning (⚠ Context used...), you MUST:
-1. Finish your current immediate step
-2. Output a HANDOFF as your final message following the format below
-
-HANDOFF FORMAT — answer each question concisely:
-
-%s
-
-RULES:
-%s`, handoffFormat, handoffRules)
+func pipeSystemPrompt(t *template.Template, d promptData) (string, error) {
+	return executePrompt(t, promptPipeSystem, d)
 }
 
 // buildContinuationPrompt constructs the prompt for session 2+.
 // handoffSource can be a file path (TTY mode) or raw text (pipe mode).
-func buildContinuationPrompt(sessionNum int, task, handoffSource string) string {
-	handoff := handoffSource
-	sourceLabel := handoffSource
+// The git fields of d are set by the caller, see setGitState. Parts that
+// do not fit the budget are cut; their names are returned.
+func buildContinuationPrompt(t *template.Template, d promptData, handoffSource string) (string, []string, error) {
+	text := handoffSource
+	d.HandoffSource = handoffSource
 	if data, err := os.ReadFile(handoffSource); err == nil {
-		handoff = string(data)
+		text = string(data)
 	} else {
-		sourceLabel = "(inline text)"
+		d.HandoffSource = "(inline text)"
 	}
-
-	gitState := runGit("diff", "--stat", "HEAD~1", "HEAD")
-	if gitState == "" {
-		gitState = "(no git history)"
+	h := parseHandoff(text)
+	d.PreviousHandoff = h.text()
+	d.FrontMatter = h.FrontMatter
+
+	sectioned := len(h.Sections) > 0 && len(h.Missing) == 0
+	render := func() (string, error) {
+		if sectioned {
+			d.PreviousHandoff = h.text()
+		}
+		return executePrompt(t, promptContinuation, d)
 	}
-	gitStatus := runGit("status", "--short")
-
-	return fmt.Sprintf(`You are session %d of an autonomous state machine. You are resuming from session %d.
-
-CRITICAL: You are AUTONOMOUS. Do NOT ask the human anything. Do NOT wait for confirmation. Read the handoff, understand the state, and EXECUTE immediately.
-
-## Original Task
-%s
+	cut, err := d.budget.fit(d.Session, budgetParts(&d, h), render)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := render()
+	return out, cut, err
+}
 
-## Auto-recovered State (from git)
-`+"`"+"`"+"`"+`
-%s
-%s
-`+"`"+"`"+"`"+`
+// setBudget limits the continuation prompt to tokens (0 = unlimited),
+// saving the full text of cut parts to dir.
+func (d *promptData) setBudget(tokens int, dir string) {
+	d.budget = promptBudget{Tokens: tokens, Dir: dir}
+}
 
-## Handoff from Previous Session (source: %s)
-%s
+// runPrompts implements 'icc prompts render NAME [OPTIONS] [TASK]', which
+// prints a prompt as a session would receive it, using the project's
+// templates.
+func runPrompts(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `Usage: icc prompts render system|pipe|continuation [OPTIONS] [TASK]
+
+Options:
+  --session N        Session number (default: 2)
+  --max-sessions N   Max sessions (default: 0 = unlimited)
+  --handoff FILE     Previous handoff for the continuation prompt
+  --prompt-budget N  Continuation prompt budget in tokens (default: 16000, 0 = unlimited)`)
+		os.Exit(1)
+	}
+	if len(args) < 2 || args[0] != "render" {
+		usage()
+	}
+	name, ok := promptNames[args[1]]
+	if !ok {
+		usage()
+	}
 
-Read the handoff above carefully before doing anything.
-- Q0 gives you project orientation
-- Q1 tells you exactly where to start
-- Q2 tells you what NOT to try — respect these, they were learned the hard way
-- Q3 explains decisions that might look wrong but aren't
-- Q4 flags risks you should verify early
+	session, maxSessions := 2, 0
+	budget := envIntOrDefault("ICC_PROMPT_BUDGET", defaultPromptBudget)
+	task, handoff := "(task)", "(previous handoff)"
+	for i := 2; i < len(args); {
+		switch args[i] {
+		case "--session":
+			session = requireIntArg(args, i, "--session")
+			i += 2
+		case "--max-sessions":
+			maxSessions = requireIntArg(args, i, "--max-sessions")
+			i += 2
+		case "--handoff":
+			handoff = requireArg(args, i, "--handoff")
+			i += 2
+		case "--prompt-budget":
+			budget = requireIntArg(args, i, "--prompt-budget")
+			i += 2
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				usage()
+			}
+			task = args[i]
+			i++
+		}
+	}
 
-Now execute. Do not ask questions. Do not wait for approval. Start working.`,
-		sessionNum, sessionNum-1, task, gitState, gitStatus, sourceLabel, handoff)
+	templates, err := loadPromptTemplates(promptTemplatesDir())
+	if err != nil {
+		errMsg("Failed to load prompt templates: %v", err)
+		os.Exit(1)
+	}
+	d := newPromptData(session, maxSessions, task)
+	d.HandoffPath = "/tmp/icc-handoff-" + randomHex(3) + ".md"
+	d.setPlan(planPath(filepath.Join(runsDir(), "<run>")))
+	var out string
+	if name == promptContinuation {
+		// Outside a run, show the changes since the last commit.
+		head := headSnapshot()
+		d.setGitState(head, head, takeGitSnapshot())
+		// Cut parts go to a private directory, not straight into the
+		// shared temp dir, where other users could plant or read them.
+		dir, tmpErr := os.MkdirTemp("", "icc-prompts-")
+		if tmpErr != nil {
+			errMsg("%v", tmpErr)
+			os.Exit(1)
+		}
+		d.setBudget(budget, dir)
+		var cut []string
+		if out, cut, err = buildContinuationPrompt(templates, d, handoff); len(cut) > 0 {
+			fmt.Fprintf(os.Stderr, "Cut to fit the prompt budget: %s (full text in %s)\n", strings.Join(cut, ", "), dir)
+		} else {
+			os.RemoveAll(dir)
+		}
+	} else {
+		out, err = executePrompt(templates, name, d)
+	}
+	if err != nil {
+		errMsg("%v", err)
+		os.Exit(1)
+	}
+	fmt.Println(out)
 }
 
+// runGit returns git's output without trailing whitespace, or "" on error.
+// Leading whitespace is kept: it is significant in 'status --short' and
+// diff stats.
 func runGit(args ...string) string {
 	cmd := exec.Command("git", args...)
 	out, err := cmd.Output()
 	if err != nil {
 		return ""
 	}
-	return strings.TrimSpace(string(out))
+	return strings.TrimRight(string(out), " \t\r\n")
 }
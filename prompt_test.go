@@ -5,11 +5,17 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"text/template"
 )
 
 func TestRenderSystemPrompt(t *testing.T) {
 	path := "/tmp/icc-handoff-abc123.md"
-	got := renderSystemPrompt(path)
+	d := newPromptData(1, 0, "task")
+	d.HandoffPath = path
+	got, err := renderSystemPrompt(testTemplates(t), d)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	t.Run("contains handoff path", func(t *testing.T) {
 		if !strings.Contains(got, path) {
@@ -45,7 +51,10 @@ func TestRenderSystemPrompt(t *testing.T) {
 }
 
 func TestPipeSystemPrompt(t *testing.T) {
-	got := pipeSystemPrompt()
+	got, err := pipeSystemPrompt(testTemplates(t), newPromptData(1, 0, "task"))
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	t.Run("contains relay protocol", func(t *testing.T) {
 		if !strings.Contains(got, "ICC RELAY PROTOCOL") {
@@ -73,8 +82,17 @@ func TestPipeSystemPrompt(t *testing.T) {
 }
 
 func TestBuildContinuationPrompt(t *testing.T) {
+	continuationPrompt := func(t *testing.T, session int, task, source string) string {
+		t.Helper()
+		got, _, err := buildContinuationPrompt(testTemplates(t), newPromptData(session, 0, task), source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
 	t.Run("embeds session number and task", func(t *testing.T) {
-		got := buildContinuationPrompt(3, "Build a REST API", "handoff text here")
+		got := continuationPrompt(t, 3, "Build a REST API", "handoff text here")
 
 		if !strings.Contains(got, "session 3") {
 			t.Error("prompt missing session number")
@@ -95,7 +113,7 @@ func TestBuildContinuationPrompt(t *testing.T) {
 		handoffFile := filepath.Join(dir, "handoff.md")
 		os.WriteFile(handoffFile, []byte("## Q0: file-based handoff content"), 0644)
 
-		got := buildContinuationPrompt(2, "my task", handoffFile)
+		got := continuationPrompt(t, 2, "my task", handoffFile)
 
 		if !strings.Contains(got, "file-based handoff content") {
 			t.Error("prompt should contain file content when handoff path is a valid file")
@@ -106,7 +124,7 @@ func TestBuildContinuationPrompt(t *testing.T) {
 	})
 
 	t.Run("uses raw string when file does not exist", func(t *testing.T) {
-		got := buildContinuationPrompt(2, "my task", "raw handoff notes")
+		got := continuationPrompt(t, 2, "my task", "raw handoff notes")
 
 		if !strings.Contains(got, "raw handoff notes") {
 			t.Error("prompt should fall back to raw string when file doesn't exist")
@@ -114,9 +132,113 @@ func TestBuildContinuationPrompt(t *testing.T) {
 	})
 
 	t.Run("contains autonomous instruction", func(t *testing.T) {
-		got := buildContinuationPrompt(2, "task", "handoff")
+		got := continuationPrompt(t, 2, "task", "handoff")
 		if !strings.Contains(got, "AUTONOMOUS") {
 			t.Error("continuation prompt missing AUTONOMOUS instruction")
 		}
 	})
+
+	t.Run("mentions remaining sessions when capped", func(t *testing.T) {
+		got, _, err := buildContinuationPrompt(testTemplates(t), newPromptData(2, 5, "task"), "handoff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "At most 3 more session(s)") {
+			t.Errorf("prompt should state the remaining sessions:\n%s", got)
+		}
+		if got := continuationPrompt(t, 2, "task", "handoff"); strings.Contains(got, "more session(s)") {
+			t.Error("unlimited runs should not mention remaining sessions")
+		}
+	})
+}
+
+func testTemplates(t *testing.T) *template.Template {
+	t.Helper()
+	tmpl, err := loadPromptTemplates(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestNewPromptData(t *testing.T) {
+	tests := []struct {
+		session, max, want int
+	}{
+		{1, 0, -1},
+		{1, 5, 4},
+		{5, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := newPromptData(tt.session, tt.max, "task").RemainingSessions; got != tt.want {
+			t.Errorf("newPromptData(%d, %d).RemainingSessions = %d, want %d", tt.session, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPromptTemplates(t *testing.T) {
+	t.Run("partials are included without extra blank lines", func(t *testing.T) {
+		d := newPromptData(1, 0, "task")
+		got, err := renderSystemPrompt(testTemplates(t), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "```markdown\n---\n{") || !strings.Contains(got, "false confidence.)\n```") {
+			t.Errorf("handoff format not embedded cleanly:\n%s", got)
+		}
+	})
+
+	t.Run("project template overrides a default", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(filepath.Join(dir, "handoff-format.tmpl"), "## Q0: What did you find?\n## Q1: Which source next?\n")
+		tmpl, err := loadPromptTemplates(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := pipeSystemPrompt(tmpl, newPromptData(1, 0, "task"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "Which source next?") {
+			t.Error("override not used")
+		}
+		if strings.Contains(got, "Q4:") {
+			t.Error("default handoff format still present")
+		}
+		if !strings.Contains(got, "ICC RELAY PROTOCOL") {
+			t.Error("templates that were not overridden should keep their defaults")
+		}
+	})
+
+	t.Run("broken override is rejected at load", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"syntax.tmpl":       "{{if}}",
+			"continuation.tmpl": "{{.NoSuchField}}",
+		} {
+			dir := t.TempDir()
+			writeTestFile(filepath.Join(dir, name), content)
+			if _, err := loadPromptTemplates(dir); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
+
+func TestBuildContinuationPromptFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "handoff.md")
+	writeTestFile(path, "---\n{\"status\": \"blocked\", \"next_steps\": [\"ask for the API key\"], \"tests\": \"failing\", \"failing_tests\": [\"TestAuth\"]}\n---\n## Q0: State\nAuth is stubbed.\n")
+
+	got, _, err := buildContinuationPrompt(testTemplates(t), newPromptData(2, 0, "task"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Status: blocked (tests failing)", "Failing tests:\n- TestAuth", "Next steps:\n- ask for the API key", "Auth is stubbed."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `"status"`) {
+		t.Error("raw front-matter should not be pasted into the prompt")
+	}
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// runIDRe is what a run ID may contain. IDs come from --name and the
+// command line and name a directory that newRun deletes, so they must not
+// be able to reach outside runsDir.
+var runIDRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// checkRunID rejects run IDs that are not a single plain path element.
+func checkRunID(id string) error {
+	if !runIDRe.MatchString(id) || id == "." || id == ".." {
+		return fmt.Errorf("invalid run name %q (use letters, digits, '.', '_' and '-')", id)
+	}
+	return nil
+}
+
+// runsDir is where per-run state is kept, one directory per run. The run
+// settings in it hold hook commands claude runs, so it is private to the
+// user rather than in the shared temp dir. ICC_RUNS_DIR overrides the
+// default.
+func runsDir() string {
+	return envOrDefault("ICC_RUNS_DIR", userStateDir("runs"))
+}
+
+// makeRunsDir creates the runs directory if needed and checks that no one
+// else owns it or can write to it.
+func makeRunsDir() error {
+	dir := runsDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if !privateDir(dir) {
+		return fmt.Errorf("%s is owned by another user or writable by others; remove it or set ICC_RUNS_DIR", dir)
+	}
+	return nil
+}
+
+// runManifest is the run history persisted as manifest.json in the run
+// directory. Only the supervisor writes it.
+type runManifest struct {
+	ID        string    `json:"id"`
+	Task      string    `json:"task"`
+	Mode      string    `json:"mode"`           // "tty" or "pipe"
+	Workdir   string    `json:"workdir"`        // where claude runs
+	Pane      string    `json:"pane,omitempty"` // TTY: tmux target of the claude pane
+	StartedAt time.Time `json:"started_at"`
+
+	// GitBase is the repository state when the run started; nil outside
+	// a git repository.
+	GitBase *gitSnapshot `json:"git_base,omitempty"`
+
+	// HandoffPath is the handoff target of the session in progress.
+	HandoffPath string `json:"handoff_path,omitempty"`
+
+	Sessions  []sessionRecord `json:"sessions,omitempty"`
+	Incidents []incident      `json:"incidents,omitempty"`
+
+	Dir string `json:"-"`
+}
+
+// sessionRecord summarizes one claude session of the run.
+type sessionRecord struct {
+	Number      int       `json:"number"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Outcome     string    `json:"outcome"`
+	Manual      bool      `json:"manual_handoff,omitempty"` // handoff requested with 'icc handoff-now'
+	Reason      string    `json:"reason,omitempty"`
+	Evidence    string    `json:"evidence,omitempty"`
+	ExitCode    *int      `json:"exit_code,omitempty"`
+	HandoffPath string    `json:"handoff_path,omitempty"`
+	Transcript  string    `json:"transcript,omitempty"`
+
+	GitStart   *gitSnapshot   `json:"git_start,omitempty"`  // repository state when the session started
+	Checkpoint string         `json:"checkpoint,omitempty"` // checkpoint commit taken after the session (--checkpoint)
+	Milestones string         `json:"milestones,omitempty"` // plan progress after the session, e.g. "milestones 7/12"
+	Handoff    *parsedHandoff `json:"handoff,omitempty"`    // the handoff this session wrote, parsed
+}
+
+// incident records a condition the supervisor had to wait out or retry.
+type incident struct {
+	Time    time.Time `json:"time"`
+	Session int       `json:"session"`
+	Kind    string    `json:"kind"`   // pane condition kind, e.g. "rate-limit"
+	Detail  string    `json:"detail"` // the matching pane line
+	Action  string    `json:"action"` // what the supervisor did about it
+}
+
+// newRun creates (or resets) the run directory for id and writes the
+// initial manifest.
+func newRun(id, task, mode string) (*runManifest, error) {
+	if err := checkRunID(id); err != nil {
+		return nil, err
+	}
+	if err := makeRunsDir(); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(runsDir(), id)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return nil, err
+	}
+	workdir, _ := os.Getwd()
+	m := &runManifest{ID: id, Task: task, Mode: mode, Workdir: workdir, StartedAt: time.Now(), Dir: dir}
+	return m, m.save()
+}
+
+// loadRun reads the manifest of an existing run.
+func loadRun(id string) (*runManifest, error) {
+	if err := checkRunID(id); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(runsDir(), id)
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("run %q not found in %s", id, runsDir())
+	}
+	var m runManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest of run %q: %w", id, err)
+	}
+	m.Dir = dir
+	return &m, nil
+}
+
+// save writes the manifest atomically so readers never see a partial file.
+func (m *runManifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(m.Dir, ".manifest.json.tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.Dir, "manifest.json"))
+}
+
+// recordSession appends a finished session to the run history and saves it.
+func (m *runManifest) recordSession(rec sessionRecord) {
+	if m == nil {
+		return
+	}
+	m.Sessions = append(m.Sessions, rec)
+	if err := m.save(); err != nil {
+		errMsg("Failed to save run manifest: %v", err)
+	}
+}
+
+// recordIncident appends an incident to the run history and saves it.
+func (m *runManifest) recordIncident(inc incident) {
+	if m == nil {
+		return
+	}
+	m.Incidents = append(m.Incidents, inc)
+	if err := m.save(); err != nil {
+		errMsg("Failed to save run manifest: %v", err)
+	}
+}
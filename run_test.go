@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewRun(t *testing.T) {
+	t.Setenv("ICC_RUNS_DIR", t.TempDir())
+
+	run, err := newRun("icc-test", "Build a REST API", "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Dir != filepath.Join(runsDir(), "icc-test") {
+		t.Errorf("unexpected run dir %s", run.Dir)
+	}
+
+	run.recordIncident(incident{Time: time.Now(), Session: 2, Kind: conditionRateLimit, Detail: "resets 3pm", Action: "paused"})
+
+	data, err := os.ReadFile(filepath.Join(run.Dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if got.Task != "Build a REST API" || got.Mode != "tty" {
+		t.Errorf("manifest = %+v", got)
+	}
+	if len(got.Incidents) != 1 || got.Incidents[0].Session != 2 {
+		t.Errorf("incident not recorded: %+v", got.Incidents)
+	}
+
+	t.Run("recreating a run clears old state", func(t *testing.T) {
+		writeTestFile(filepath.Join(run.Dir, "stale.txt"), "x")
+		if _, err := newRun("icc-test", "other", "tty"); err != nil {
+			t.Fatal(err)
+		}
+		if fileExists(filepath.Join(run.Dir, "stale.txt")) {
+			t.Error("stale file survived newRun")
+		}
+	})
+
+	t.Run("nil run ignores incidents", func(t *testing.T) {
+		var none *runManifest
+		none.recordIncident(incident{Kind: conditionAPIError})
+	})
+}
+
+func TestCheckRunID(t *testing.T) {
+	for _, id := range []string{"icc-a1b2c3", "proj_a", "v1.2"} {
+		if err := checkRunID(id); err != nil {
+			t.Errorf("checkRunID(%q) = %v", id, err)
+		}
+	}
+	for _, id := range []string{"", ".", "..", "/", "../x", "a/b", "a b", "a:b"} {
+		if err := checkRunID(id); err == nil {
+			t.Errorf("checkRunID(%q) accepted", id)
+		}
+	}
+
+	// Nothing outside the runs directory is touched.
+	root := t.TempDir()
+	runs := filepath.Join(root, "runs")
+	t.Setenv("ICC_RUNS_DIR", runs)
+	writeTestFile(filepath.Join(root, "keep.txt"), "x")
+	if _, err := newRun("..", "task", "tty"); err == nil {
+		t.Error("newRun(..) succeeded")
+	}
+	if !fileExists(filepath.Join(root, "keep.txt")) {
+		t.Error("newRun(..) deleted the parent of the runs directory")
+	}
+	if _, err := loadRun("../runs"); err == nil {
+		t.Error("loadRun(../runs) succeeded")
+	}
+}
+
+func TestNewRunPrivate(t *testing.T) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	t.Setenv("ICC_RUNS_DIR", runs)
+	run, err := newRun("icc-test", "task", "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{
+		runs:                                    0700,
+		run.Dir:                                 0700,
+		filepath.Join(run.Dir, "manifest.json"): 0600,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s: mode %v, want %v", path, info.Mode().Perm(), want)
+		}
+	}
+
+	// A runs directory others can write to is refused, not used.
+	os.Chmod(runs, 0777)
+	if _, err := newRun("icc-test", "task", "tty"); err == nil {
+		t.Error("newRun used a world-writable runs directory")
+	}
+	if !fileExists(filepath.Join(run.Dir, "manifest.json")) {
+		t.Error("refused run still deleted the old run directory")
+	}
+}
+
+func TestLoadRun(t *testing.T) {
+	t.Setenv("ICC_RUNS_DIR", t.TempDir())
+
+	run, err := newRun("icc-load", "task", "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.Pane = "icc-load:0.0"
+	run.HandoffPath = "/tmp/icc-handoff-x.md"
+	run.save()
+
+	got, err := loadRun("icc-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Pane != run.Pane || got.HandoffPath != run.HandoffPath || got.Dir != run.Dir {
+		t.Errorf("loadRun = %+v, want %+v", got, run)
+	}
+
+	if _, err := loadRun("icc-missing"); err == nil {
+		t.Error("expected error for unknown run")
+	}
+}
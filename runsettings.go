@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// runSettingsFile is the claude settings file icc writes into the run
+// directory and passes to every session with --settings.
+const runSettingsFile = "settings.json"
+
+// runSettings is the content of runSettingsFile: the context-guard hooks
+// and the environment that stays the same for the whole run. Claude merges
+// it over the user and project settings.
+type runSettings struct {
+	Hooks map[string][]settingsHookEntry `json:"hooks,omitempty"`
+	Env   map[string]string              `json:"env"`
+}
+
+type settingsHookEntry struct {
+	Hooks []settingsHook `json:"hooks"`
+}
+
+type settingsHook struct {
+	Type    string `json:"type"`
+	Command string `json:"command"`
+	Timeout int    `json:"timeout"`
+}
+
+// newRunSettings builds the run's settings. With hooks false the context
+// guard is left out, because one is already registered where claude will
+// find it and a second would repeat every warning.
+func newRunSettings(run *runManifest, cfg Config, hooks bool) runSettings {
+	s := runSettings{Env: map[string]string{
+		"CTX_WARN_TOKENS":     strconv.Itoa(cfg.WarnTokens),
+		"CTX_CRITICAL_TOKENS": strconv.Itoa(cfg.CriticalTokens),
+		"ICC_PLAN_PATH":       planPath(run.Dir),
+		"ICC_WORKDIR":         run.Workdir,
+		"ICC_HOOK_STATE_DIR":  filepath.Join(run.Dir, "hook-state"),
+		"ICC_RUN_DIR":         run.Dir,
+	}}
+	if hooks {
+		entry := []settingsHookEntry{{Hooks: []settingsHook{{Type: "command", Command: hookCommand(), Timeout: 10}}}}
+		s.Hooks = map[string][]settingsHookEntry{"PreToolUse": entry, "PostToolUse": entry}
+	}
+	return s
+}
+
+// writeRunSettings writes the run's settings file and returns its path.
+func writeRunSettings(run *runManifest, cfg Config, hooks bool) (string, error) {
+	data, err := json.MarshalIndent(newRunSettings(run, cfg, hooks), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(run.Dir, runSettingsFile)
+	return path, os.WriteFile(path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRunSettings(t *testing.T) {
+	run := &runManifest{ID: "icc-test", Dir: t.TempDir(), Workdir: "/src/project"}
+	cfg := Config{WarnTokens: 100000, CriticalTokens: 120000}
+
+	path, err := writeRunSettings(run, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(run.Dir, "settings.json") {
+		t.Errorf("path = %s", path)
+	}
+	st := readHookStatus(path)
+	if len(st.Events) != 2 || len(st.Commands) != 1 || st.Commands[0] != hookCommand() {
+		t.Errorf("hook status = %+v, want %s for both events", st, hookCommand())
+	}
+
+	data, _ := os.ReadFile(path)
+	var s runSettings
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"CTX_WARN_TOKENS":     "100000",
+		"CTX_CRITICAL_TOKENS": "120000",
+		"ICC_PLAN_PATH":       filepath.Join(run.Dir, "plan.md"),
+		"ICC_WORKDIR":         "/src/project",
+		"ICC_HOOK_STATE_DIR":  filepath.Join(run.Dir, "hook-state"),
+		"ICC_RUN_DIR":         run.Dir,
+	}
+	for k, v := range want {
+		if s.Env[k] != v {
+			t.Errorf("env %s = %q, want %q", k, s.Env[k], v)
+		}
+	}
+
+	t.Run("without hooks", func(t *testing.T) {
+		path, err := writeRunSettings(run, cfg, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st := readHookStatus(path); len(st.Commands) != 0 {
+			t.Errorf("hooks written: %v", st.Commands)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Startup screen actions.
+const (
+	actionTrust   = "trust"   // accept a folder-trust prompt, but only for the run's workdir
+	actionAccept  = "accept"  // confirm a prompt by sending Keys
+	actionDismiss = "dismiss" // close a notice by sending Keys
+	actionFail    = "fail"    // abort the run with Message
+)
+
+// startupScreen describes a screen claude may show before its ❯ input prompt.
+type startupScreen struct {
+	Name    string   `json:"name"`
+	Match   string   `json:"match"`             // regexp matched against the bottom of the pane
+	Action  string   `json:"action"`            // trust, accept, dismiss or fail
+	Keys    []string `json:"keys,omitempty"`    // tmux key names sent for trust/accept/dismiss
+	Message string   `json:"message,omitempty"` // shown when the run is aborted
+
+	re *regexp.Regexp
+}
+
+// defaultStartupScreens lists the screens known from current claude versions.
+// Entries are checked in order; the first match wins.
+var defaultStartupScreens = []startupScreen{
+	{
+		Name:   "trust-folder",
+		Match:  `(?i)do you trust the files in this folder|project you created or one you trust`,
+		Action: actionTrust,
+		Keys:   []string{"Enter"},
+	},
+	{
+		Name:   "bypass-permissions",
+		Match:  `(?i)bypass permissions mode`,
+		Action: actionAccept,
+		Keys:   []string{"Down", "Enter"},
+	},
+	{
+		Name:    "login",
+		Match:   `(?i)select login method|please run /login|invalid api key|oauth token has expired`,
+		Action:  actionFail,
+		Message: "claude is not logged in. Run 'claude' once in a terminal and log in, or set CLAUDE_BIN to a wrapper that provides credentials.",
+	},
+	{
+		Name:    "onboarding",
+		Match:   `(?i)choose the text style|let's get started`,
+		Action:  actionFail,
+		Message: "claude has not finished first-run onboarding. Run 'claude' once in a terminal and complete the setup.",
+	},
+	{
+		Name:   "press-enter",
+		Match:  `(?i)press enter to continue`,
+		Action: actionDismiss,
+		Keys:   []string{"Enter"},
+	},
+}
+
+// startupScreensPath returns the config file that extends the screen table.
+// ICC_STARTUP_SCREENS overrides the project-level .icc/startup-screens.json.
+func startupScreensPath() string {
+	return envOrDefault("ICC_STARTUP_SCREENS", filepath.Join(".icc", "startup-screens.json"))
+}
+
+// loadStartupScreens returns the configured screens followed by the defaults.
+// A configured screen with the same name as a default replaces it.
+// A missing config file is not an error.
+func loadStartupScreens(path string) ([]startupScreen, error) {
+	var custom []startupScreen
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	overridden := map[string]bool{}
+	for _, s := range custom {
+		overridden[s.Name] = true
+	}
+	screens := append([]startupScreen{}, custom...)
+	for _, s := range defaultStartupScreens {
+		if !overridden[s.Name] {
+			screens = append(screens, s)
+		}
+	}
+
+	for i := range screens {
+		s := &screens[i]
+		switch s.Action {
+		case actionTrust, actionAccept, actionDismiss, actionFail:
+		default:
+			return nil, fmt.Errorf("startup screen %q: unknown action %q", s.Name, s.Action)
+		}
+		re, err := regexp.Compile(s.Match)
+		if err != nil {
+			return nil, fmt.Errorf("startup screen %q: %w", s.Name, err)
+		}
+		s.re = re
+	}
+	return screens, nil
+}
+
+// matchStartupScreen returns the first screen whose pattern matches the pane text.
+func matchStartupScreen(screens []startupScreen, paneText string) *startupScreen {
+	for i := range screens {
+		if screens[i].re != nil && screens[i].re.MatchString(paneText) {
+			return &screens[i]
+		}
+	}
+	return nil
+}
+
+// paneShowsDir reports whether the pane text mentions dir, either as an
+// absolute path or abbreviated with ~ the way claude prints it. The path
+// must stand as a whole: /home/u/proj does not match /home/u/proj-other.
+func paneShowsDir(paneText, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	if containsPath(paneText, dir) {
+		return true
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		if dir == home {
+			return containsPath(paneText, "~")
+		}
+		if rest, ok := strings.CutPrefix(dir, home+"/"); ok {
+			return containsPath(paneText, "~/"+rest)
+		}
+	}
+	return false
+}
+
+// containsPath reports whether text holds path as a whole token: not
+// preceded by a path character, and followed by the end of the text,
+// whitespace or a path separator.
+func containsPath(text, path string) bool {
+	for i := 0; ; {
+		j := strings.Index(text[i:], path)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(path)
+		before := start == 0 || !isPathChar(text[start-1])
+		after := end == len(text) || text[end] == '/' || strings.ContainsRune(" \t\r\n", rune(text[end]))
+		if before && after {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isPathChar(c byte) bool {
+	return c == '/' || c == '~' || c == '.' || c == '_' || c == '-' ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
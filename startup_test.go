@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchStartupScreen(t *testing.T) {
+	screens, err := loadStartupScreens("/nonexistent/startup-screens.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pane string
+		want string
+	}{
+		{"trust prompt", "Do you trust the files in this folder?\n\n/home/u/proj\n\n❯ 1. Yes, proceed\n  2. No, exit", "trust-folder"},
+		{"new trust prompt", "Quick safety check: Is this a project you created or one you trust?\n❯ 1. Yes, I trust this folder", "trust-folder"},
+		{"bypass confirmation", "WARNING: Claude Code running in Bypass Permissions mode\n❯ 1. No, exit\n  2. Yes, I accept", "bypass-permissions"},
+		{"login screen", "Select login method:\n❯ 1. Claude account with subscription", "login"},
+		{"invalid key", "Invalid API key · Please run /login", "login"},
+		{"update notice", "Update installed. Press Enter to continue…", "press-enter"},
+		{"ready prompt", "╭────╮\n│ ❯  │\n╰────╯", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if s := matchStartupScreen(screens, tt.pane); s != nil {
+				got = s.Name
+			}
+			if got != tt.want {
+				t.Errorf("matchStartupScreen = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadStartupScreens(t *testing.T) {
+	t.Run("config entries take precedence", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "screens.json")
+		writeTestFile(path, `[
+			{"name": "login", "match": "Select login method", "action": "accept", "keys": ["Enter"]},
+			{"name": "survey", "match": "How is Claude doing", "action": "dismiss", "keys": ["Escape"]}
+		]`)
+
+		screens, err := loadStartupScreens(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(screens) != len(defaultStartupScreens)+1 {
+			t.Errorf("got %d screens, want %d", len(screens), len(defaultStartupScreens)+1)
+		}
+		if s := matchStartupScreen(screens, "Select login method:"); s == nil || s.Action != actionAccept {
+			t.Errorf("config entry should replace the default login screen, got %+v", s)
+		}
+		if s := matchStartupScreen(screens, "How is Claude doing this session?"); s == nil || s.Name != "survey" {
+			t.Errorf("config entry should extend the table, got %+v", s)
+		}
+	})
+
+	t.Run("rejects unknown action", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "screens.json")
+		writeTestFile(path, `[{"name": "x", "match": "x", "action": "explode"}]`)
+		if _, err := loadStartupScreens(path); err == nil {
+			t.Error("expected error for unknown action")
+		}
+	})
+
+	t.Run("rejects invalid regexp", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "screens.json")
+		writeTestFile(path, `[{"name": "x", "match": "(", "action": "fail"}]`)
+		if _, err := loadStartupScreens(path); err == nil {
+			t.Error("expected error for invalid regexp")
+		}
+	})
+}
+
+func TestPaneShowsDir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	dir := filepath.Join(home, "work", "proj")
+
+	if !paneShowsDir("Do you trust\n"+dir+"\n", dir) {
+		t.Error("expected match on absolute path")
+	}
+	if !paneShowsDir("Do you trust\n~/work/proj\n", dir) {
+		t.Error("expected match on ~-abbreviated path")
+	}
+	if paneShowsDir("Do you trust\n/srv/other\n", dir) {
+		t.Error("expected no match for a different folder")
+	}
+	if !paneShowsDir("│ "+dir+" │", dir) || !paneShowsDir(dir+"/", dir) {
+		t.Error("expected match on a path followed by a space or separator")
+	}
+	for _, text := range []string{
+		dir + "-other\n",
+		"~/work/proj-other\n",
+		"/mnt" + dir + "\n",
+		home + "2/work/proj\n",
+	} {
+		if paneShowsDir("Do you trust\n"+text, dir) {
+			t.Errorf("expected no match for %q", text)
+		}
+	}
+	// A home of /home/u must not turn /home/u2/work into ~2/work.
+	t.Setenv("HOME", "/home/u")
+	if paneShowsDir("Do you trust\n~2/work\n", "/home/u2/work") {
+		t.Error("home prefix matched without a separator")
+	}
+	if !paneShowsDir("Do you trust\n~/work\n", "/home/u/work") {
+		t.Error("expected match on ~/work")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var nonAlnumRe = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+// claudeProjectDir returns the directory where claude stores transcripts
+// for sessions started in workdir: ~/.claude/projects/<workdir with every
+// non-alphanumeric character replaced by "-">.
+func claudeProjectDir(workdir string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".claude", "projects", nonAlnumRe.ReplaceAllString(workdir, "-"))
+}
+
+// transcriptPathFile, in the run directory, holds the transcript path of
+// the session in progress as the hook last received it.
+const transcriptPathFile = "transcript-path"
+
+// recordTranscriptPath saves the transcript path from a hook payload for
+// the supervisor. The file is only rewritten when the path changes.
+func recordTranscriptPath(runDir, transcript string) {
+	path := filepath.Join(runDir, transcriptPathFile)
+	if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) == transcript {
+		return
+	}
+	tmp, err := os.CreateTemp(runDir, ".transcript-path-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.WriteString(transcript + "\n")
+	if err := errors.Join(err, tmp.Close()); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// sessionTranscript returns the transcript of the run's session in
+// progress: the path the hook recorded. With guess set, for runs without
+// the hook, it falls back to the newest transcript in workdir's project
+// directory written since since, which may belong to another claude
+// session in the same directory.
+func sessionTranscript(runDir, workdir string, since time.Time, guess bool) string {
+	if data, err := os.ReadFile(filepath.Join(runDir, transcriptPathFile)); err == nil {
+		if path := strings.TrimSpace(string(data)); path != "" {
+			return path
+		}
+	}
+	if guess {
+		return latestTranscript(claudeProjectDir(workdir), since)
+	}
+	return ""
+}
+
+// latestTranscript returns the most recently modified transcript JSONL in
+// dir that was written at or after since, or "" if there is none.
+func latestTranscript(dir string, since time.Time) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	best := ""
+	var bestMod time.Time
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".jsonl") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		if best == "" || info.ModTime().After(bestMod) {
+			best = filepath.Join(dir, e.Name())
+			bestMod = info.ModTime()
+		}
+	}
+	return best
+}
+
+// transcriptMessage is a user or assistant message reduced to text.
+type transcriptMessage struct {
+	Role string
+	Text string
+}
+
+// transcriptEntry is the subset of a transcript JSONL line icc reads.
+type transcriptEntry struct {
+	Type    string `json:"type"`
+	Message struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+// messageText flattens message content (a string or an array of blocks)
+// to text. Tool calls are shown by name; tool results are skipped.
+func messageText(content json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(content, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return ""
+	}
+	var parts []string
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			if t := strings.TrimSpace(b.Text); t != "" {
+				parts = append(parts, t)
+			}
+		case "tool_use":
+			parts = append(parts, "[tool: "+b.Name+"]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// transcriptTail returns the last n user/assistant messages of a
+// transcript that have text, oldest first.
+func transcriptTail(path string, n int) []transcriptMessage {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var msgs []transcriptMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e transcriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.Type != "user" && e.Type != "assistant" {
+			continue
+		}
+		text := messageText(e.Message.Content)
+		if text == "" {
+			continue
+		}
+		msgs = append(msgs, transcriptMessage{Role: e.Type, Text: text})
+		if len(msgs) > n {
+			msgs = msgs[1:]
+		}
+	}
+	return msgs
+}
+
+// formatTranscriptTail renders messages for a prompt, truncating each to
+// maxChars.
+func formatTranscriptTail(msgs []transcriptMessage, maxChars int) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		b.WriteString("[" + m.Role + "] " + truncateText(m.Text, maxChars) + "\n\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// truncateText cuts s to at most max bytes on a rune boundary, marking the cut.
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + " …"
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaudeProjectDir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	got := claudeProjectDir("/Users/me/my.proj_x")
+	want := filepath.Join(home, ".claude", "projects", "-Users-me-my-proj-x")
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLatestTranscript(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.jsonl")
+	recent := filepath.Join(dir, "recent.jsonl")
+	writeTestFile(old, "{}")
+	writeTestFile(recent, "{}")
+	writeTestFile(filepath.Join(dir, "notes.txt"), "x")
+
+	start := time.Now()
+	os.Chtimes(old, start.Add(-time.Hour), start.Add(-time.Hour))
+	os.Chtimes(recent, start.Add(time.Second), start.Add(time.Second))
+
+	if got := latestTranscript(dir, start); got != recent {
+		t.Errorf("got %q, want %q", got, recent)
+	}
+	if got := latestTranscript(dir, start.Add(time.Minute)); got != "" {
+		t.Errorf("expected no transcript after since, got %q", got)
+	}
+	if got := latestTranscript(filepath.Join(dir, "missing"), start); got != "" {
+		t.Errorf("expected empty result for missing dir, got %q", got)
+	}
+}
+
+func TestSessionTranscript(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	workdir := "/work/proj"
+	projectDir := claudeProjectDir(workdir)
+	os.MkdirAll(projectDir, 0755)
+	other := filepath.Join(projectDir, "other-session.jsonl")
+	writeTestFile(other, "{}")
+	runDir := t.TempDir()
+
+	// Another session's transcript is never taken for the run's own.
+	if got := sessionTranscript(runDir, workdir, time.Time{}, false); got != "" {
+		t.Errorf("without a recorded path: %q, want none", got)
+	}
+	if got := sessionTranscript(runDir, workdir, time.Time{}, true); got != other {
+		t.Errorf("guessing without a hook: %q, want %q", got, other)
+	}
+
+	ours := filepath.Join(projectDir, "ours.jsonl")
+	recordTranscriptPath(runDir, ours)
+	recordTranscriptPath(runDir, ours)
+	if got := sessionTranscript(runDir, workdir, time.Time{}, true); got != ours {
+		t.Errorf("recorded path: %q, want %q", got, ours)
+	}
+}
+
+func TestTranscriptTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	lines := []string{
+		`{"type":"user","message":{"role":"user","content":"Build a REST API"}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Starting."},{"type":"tool_use","name":"Bash"}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","content":"ok"}]}}`,
+		`{"type":"summary","summary":"ignored"}`,
+		`not json`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Tests pass."}]}}`,
+	}
+	writeTestFile(path, strings.Join(lines, "\n")+"\n")
+
+	got := transcriptTail(path, 2)
+	if len(got) != 2 {
+		t.Fatalf("got %d messages %+v, want 2", len(got), got)
+	}
+	if got[0].Text != "Starting.\n[tool: Bash]" || got[1].Text != "Tests pass." {
+		t.Errorf("unexpected tail %+v", got)
+	}
+
+	formatted := formatTranscriptTail(got, 5)
+	if !strings.Contains(formatted, "[assistant] Start …") {
+		t.Errorf("expected truncated message, got %q", formatted)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("short", 10); got != "short" {
+		t.Errorf("got %q", got)
+	}
+	if got := truncateText("héllo", 2); got != "h …" {
+		t.Errorf("should cut on a rune boundary, got %q", got)
+	}
+}
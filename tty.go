@@ -3,9 +3,15 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -32,7 +38,16 @@ func tmuxSendLiteral(pane, text string) {
 	tmuxCmd("send-keys", "-t", pane, "-l", text)
 }
 
+// promptMu serializes sendPrompt within icc: the context monitor may send
+// while waitForSignal nudges the agent. Each paste goes through its own
+// named buffer, so pastes from other processes ('icc handoff-now') cannot
+// swap the text either.
+var promptMu sync.Mutex
+
 func sendPrompt(pane, prompt string) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
 	tmpfile, err := os.CreateTemp("", "icc-prompt-")
 	if err != nil {
 		errMsg("Failed to create temp file: %v", err)
@@ -42,8 +57,9 @@ func sendPrompt(pane, prompt string) {
 	tmpfile.WriteString(prompt)
 	tmpfile.Close()
 
-	tmuxCmd("load-buffer", tmpPath)
-	tmuxCmd("paste-buffer", "-p", "-t", pane)
+	buffer := "icc-" + randomHex(4)
+	tmuxCmd("load-buffer", "-b", buffer, tmpPath)
+	tmuxCmd("paste-buffer", "-d", "-b", buffer, "-p", "-t", pane)
 	os.Remove(tmpPath)
 
 	time.Sleep(300 * time.Millisecond)
@@ -57,6 +73,59 @@ func runTTY(cfg Config) {
 	}
 	pane := tmuxSession + ":0.0"
 
+	run, err := newRun(tmuxSession, cfg.Task, "tty")
+	if err != nil {
+		errMsg("Failed to create run directory: %v", err)
+		os.Exit(1)
+	}
+	run.Pane = pane
+
+	workdir, err := os.Getwd()
+	if err != nil {
+		errMsg("Cannot determine working directory: %v", err)
+		os.Exit(1)
+	}
+	screens, err := loadStartupScreens(startupScreensPath())
+	if err != nil {
+		errMsg("Failed to load startup screens: %v", err)
+		os.Exit(1)
+	}
+	conditions, err := loadPaneConditions(paneConditionsPath())
+	if err != nil {
+		errMsg("Failed to load pane conditions: %v", err)
+		os.Exit(1)
+	}
+	templates, err := loadPromptTemplates(promptTemplatesDir())
+	if err != nil {
+		errMsg("Failed to load prompt templates: %v", err)
+		os.Exit(1)
+	}
+	hookInstalled := hookActive(workdir)
+	if !hookInstalled {
+		warnLegacyHook(workdir)
+	}
+	settingsPath, err := writeRunSettings(run, cfg, !hookInstalled && !cfg.NoHooks)
+	if err != nil {
+		errMsg("Failed to write run settings: %v", err)
+		os.Exit(1)
+	}
+
+	run.GitBase = takeGitSnapshot()
+	if err := run.save(); err != nil {
+		errMsg("Failed to save run manifest: %v", err)
+	}
+	if cfg.Checkpoint && (run.GitBase == nil || !validCheckpointRef(run.ID)) {
+		errMsg("--checkpoint needs a git repository and a run name usable in a git ref")
+		os.Exit(1)
+	}
+	prevSnapshot := run.GitBase
+	// Outside git, changes are found by comparing file contents.
+	var fileBase *fileSnapshot
+	if run.GitBase == nil {
+		fileBase = takeFileSnapshot(run.Workdir, nil)
+	}
+	prevFiles := fileBase
+
 	// Kill any existing session with this name
 	tmuxCmd("kill-session", "-t", tmuxSession)
 
@@ -77,25 +146,95 @@ func runTTY(cfg Config) {
 	} else {
 		fmt.Printf("  Session timeout: unlimited\n")
 	}
+	if cfg.IdleTimeout > 0 {
+		fmt.Printf("  Idle timeout: %ds (%s)\n", cfg.IdleTimeout, cfg.IdlePolicy)
+	} else {
+		fmt.Printf("  Idle timeout: off\n")
+	}
+	if hookInstalled {
+		fmt.Printf("  Context guard: hook (installed)\n")
+	} else if cfg.NoHooks {
+		fmt.Printf("  Context guard: supervisor (--no-hooks)\n")
+	} else {
+		fmt.Printf("  Context guard: hook (run settings)\n")
+	}
+	fmt.Printf("  Run dir: %s\n", run.Dir)
+	if cfg.Checkpoint {
+		fmt.Printf("  Checkpoints: %ss<N> (icc checkpoints %s)\n", checkpointRefPrefix(tmuxSession), tmuxSession)
+	}
 	fmt.Printf("  Attach: %stmux attach -t %s%s\n", colorBold, tmuxSession, colorReset)
+	if cfg.HandoffKey != "" {
+		fmt.Printf("  Force handoff: icc handoff-now %s (or prefix+%s in tmux)\n", tmuxSession, cfg.HandoffKey)
+	} else {
+		fmt.Printf("  Force handoff: icc handoff-now %s\n", tmuxSession)
+	}
 	fmt.Printf("%s%s══════════════════════════════════════════%s\n", colorBold, colorBlue, colorReset)
 
-	tmuxCmd("new-session", "-d", "-s", tmuxSession, "-x", "200", "-y", "50")
+	tmuxCmd("new-session", "-d", "-s", tmuxSession, "-x", "200", "-y", "50", "-c", workdir)
 	time.Sleep(1 * time.Second)
+	if cfg.HandoffKey != "" {
+		defer bindHandoffKey(tmuxSession, cfg.HandoffKey)()
+	}
+
+	// Ctrl-C ends the current session and the run instead of killing icc
+	// with claude still running in tmux.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	plan := planPath(run.Dir)
+	os.Setenv("ICC_PLAN_PATH", plan)
 
 	prevHandoffPath := ""
 	lastSession := 0
+	crashes := 0
+	blocked := 0
+	planBlocks := 0
 
 sessionLoop:
 	for i := 1; cfg.MaxSessions == 0 || i <= cfg.MaxSessions; i++ {
 		lastSession = i
-		printSessionHeader(i, cfg.MaxSessions)
+		printSessionHeader(i, cfg.MaxSessions, loadPlan(plan).progress())
 
 		handoffPath := fmt.Sprintf("/tmp/icc-handoff-%s.md", randomHex(3))
 		os.Setenv("ICC_HANDOFF_PATH", handoffPath)
 		logMsg("Handoff path: %s", handoffPath)
+		run.HandoffPath = handoffPath
+		if err := run.save(); err != nil {
+			errMsg("Failed to save run manifest: %v", err)
+		}
 
-		sysprompt := renderSystemPrompt(handoffPath)
+		snapshot := run.GitBase
+		if i > 1 {
+			snapshot = takeGitSnapshot()
+		}
+		files := fileBase
+		if i > 1 && fileBase != nil {
+			files = takeFileSnapshot(run.Workdir, prevFiles)
+		}
+		data := newPromptData(i, cfg.MaxSessions, cfg.Task)
+		data.HandoffPath = handoffPath
+		data.setPlan(plan)
+		sysprompt, err := renderSystemPrompt(templates, data)
+		if err != nil {
+			errMsg("Failed to render system prompt: %v", err)
+			break sessionLoop
+		}
+		prompt := cfg.Task
+		if i > 1 && prevHandoffPath != "" {
+			data.setGitState(run.GitBase, prevSnapshot, snapshot)
+			data.setFileState(fileBase, prevFiles, files)
+			data.setLedger(run, i-1)
+			data.setBudget(cfg.PromptBudget, run.Dir)
+			var cut []string
+			if prompt, cut, err = buildContinuationPrompt(templates, data, prevHandoffPath); err != nil {
+				errMsg("Failed to render continuation prompt: %v", err)
+				break sessionLoop
+			}
+			if len(cut) > 0 {
+				logMsg("Cut to fit the prompt budget: %s (full text in %s)", strings.Join(cut, ", "), run.Dir)
+			}
+		}
 		spFile, err := os.CreateTemp("/tmp", "icc-sp-")
 		if err != nil {
 			errMsg("Failed to create temp file: %v", err)
@@ -106,9 +245,12 @@ sessionLoop:
 		spFile.Close()
 
 		logMsg("Starting claude session...")
+		os.Remove(filepath.Join(run.Dir, transcriptPathFile))
+		sessionStart := time.Now()
+		exitPath := exitStatusPath(run.Dir, i)
 		claudeCmd := fmt.Sprintf(
-			"unset CLAUDECODE && ICC_HANDOFF_PATH='%s' CTX_WARN_TOKENS=%d CTX_CRITICAL_TOKENS=%d %s",
-			handoffPath, cfg.WarnTokens, cfg.CriticalTokens, claudeBin,
+			"unset CLAUDECODE && ICC_HANDOFF_PATH='%s' %s --settings '%s'",
+			handoffPath, claudeBin, settingsPath,
 		)
 		if cfg.Model != "" {
 			claudeCmd += fmt.Sprintf(" --model %s", cfg.Model)
@@ -116,90 +258,189 @@ sessionLoop:
 		claudeCmd += fmt.Sprintf(" --permission-mode %s --append-system-prompt \"$(cat %s)\"",
 			cfg.PermissionMode, spPath,
 		)
+		// Record claude's exit status so a crash can be told from a clean exit.
+		claudeCmd += fmt.Sprintf("; echo $? > '%s'", exitPath)
 		tmuxSendKeys(pane, claudeCmd, "Enter")
 
-		if !waitForClaudeReady(pane, 60*time.Second) {
-			errMsg("Claude did not start in time")
+		if err := waitForClaudeReady(pane, workdir, screens, 60*time.Second, interrupt); errors.Is(err, errInterrupted) {
+			logMsg("Interrupted while claude was starting, stopping")
+			os.Remove(spPath)
+			break sessionLoop
+		} else if err != nil {
+			errMsg("Claude did not start: %v", err)
 			os.Remove(spPath)
 			break sessionLoop
 		}
 		okMsg("Claude ready")
 
-		var prompt string
-		if i == 1 || prevHandoffPath == "" {
-			prompt = cfg.Task
-		} else {
-			prompt = buildContinuationPrompt(i, cfg.Task, prevHandoffPath)
-		}
-
 		logMsg("Sending prompt...")
 		sendPrompt(pane, prompt)
 
+		stopMonitor := contextMonitor{
+			RunDir:      run.Dir,
+			Workdir:     workdir,
+			Pane:        pane,
+			HandoffPath: handoffPath,
+			Since:       sessionStart,
+			Warn:        cfg.WarnTokens,
+			Critical:    cfg.CriticalTokens,
+			Inject:      cfg.NoHooks && !hookInstalled,
+		}.start()
+
 		logMsg("Waiting for signal (handoff file or claude exit)...")
-		signal := waitForSignal(handoffPath, pane, time.Duration(cfg.SessionTimeout)*time.Second)
+		outcome := waitForSignal(sessionWatch{
+			HandoffPath: handoffPath,
+			Pane:        pane,
+			Session:     i,
+			Timeout:     time.Duration(cfg.SessionTimeout) * time.Second,
+			Idle: idleConfig{
+				Timeout: time.Duration(cfg.IdleTimeout) * time.Second,
+				Policy:  cfg.IdlePolicy,
+				Nudge:   cfg.IdleNudge,
+			},
+			Conditions:     conditions,
+			Run:            run,
+			ExitStatusPath: exitPath,
+			Interrupt:      interrupt,
+		})
 
+		stopMonitor()
 		os.Remove(spPath)
 
-		switch signal {
-		case 0: // handoff file detected
-			okMsg("Session %d: handoff file detected at %s", i, handoffPath)
-			logMsg("Handoff content preview:")
+		// Wind claude down; a handoff written by then still counts. Ctrl-C
+		// during the exit stops the run once the session is recorded.
+		interrupted := false
+		switch outcome.Kind {
+		case OutcomeHandoff:
+			okMsg("Session %d: %s at %s", i, outcome.Reason, handoffPath)
+			if handoffRequested(run.Dir, handoffPath) {
+				logMsg("Handoff was requested manually (icc handoff-now)")
+			}
 			if data, err := os.ReadFile(handoffPath); err == nil {
-				lines := splitLines(string(data))
-				for j := 0; j < 5 && j < len(lines); j++ {
-					fmt.Printf("  %s\n", lines[j])
+				logHandoffSummary(parseHandoff(string(data)))
+			}
+			if !isShellForeground(pane) {
+				logMsg("Gracefully exiting claude...")
+				if interrupted = gracefulExit(pane, 30*time.Second, interrupt); !interrupted {
+					okMsg("Claude exited")
 				}
 			}
-
-			logMsg("Gracefully exiting claude...")
-			gracefulExit(pane, 30*time.Second)
-			okMsg("Claude exited")
-
-			prevHandoffPath = handoffPath
-
-			if cfg.MaxSessions > 0 && i >= cfg.MaxSessions {
-				logMsg("Reached max sessions (%d)", cfg.MaxSessions)
-				break sessionLoop
+		case OutcomeCompleted:
+			if !isShellForeground(pane) {
+				logMsg("Gracefully exiting claude...")
+				interrupted = gracefulExit(pane, 30*time.Second, interrupt)
 			}
-			time.Sleep(3 * time.Second)
-
-		case 1: // claude exited
-			if fileExists(handoffPath) {
-				okMsg("Session %d: claude exited with handoff", i)
-				prevHandoffPath = handoffPath
-				if cfg.MaxSessions > 0 && i >= cfg.MaxSessions {
-					logMsg("Reached max sessions (%d)", cfg.MaxSessions)
-					break sessionLoop
-				}
-				time.Sleep(3 * time.Second)
-			} else {
-				fmt.Printf("\n%s%s✓ Session %d: claude exited without handoff — task likely complete%s\n",
-					colorGreen, colorBold, i, colorReset)
-				break sessionLoop
+		case OutcomeCrashed:
+			errMsg("Session %d: claude crashed (%s)", i, outcome.Reason)
+		default:
+			errMsg("Session %d: %s (%s)", i, outcome.Kind, outcome.Reason)
+			logMsg("Exiting claude...")
+			interrupted = gracefulExit(pane, 15*time.Second, interrupt)
+			if outcome.Kind != OutcomeAborted && fileExists(handoffPath) {
+				okMsg("Session %d: handoff file found after %s at %s", i, outcome.Kind, handoffPath)
+				outcome = SessionOutcome{Kind: OutcomeHandoff, Reason: "handoff found after " + outcome.Kind.String(), Evidence: handoffPath}
 			}
+		}
 
-		case 2: // timeout
-			errMsg("Session %d timed out (%ds)", i, cfg.SessionTimeout)
-			logMsg("Force-exiting claude...")
-			gracefulExit(pane, 15*time.Second)
-			if fileExists(handoffPath) {
-				okMsg("Session %d: handoff file found after timeout at %s", i, handoffPath)
-				prevHandoffPath = handoffPath
-				if cfg.MaxSessions > 0 && i >= cfg.MaxSessions {
-					break sessionLoop
-				}
-				time.Sleep(3 * time.Second)
+		if outcome.Kind == OutcomeCrashed {
+			crashes++
+		} else {
+			crashes = 0
+		}
+		rec := sessionRecord{
+			Number:      i,
+			StartedAt:   sessionStart,
+			EndedAt:     time.Now(),
+			Outcome:     outcome.Kind.String(),
+			Manual:      outcome.Kind == OutcomeHandoff && handoffRequested(run.Dir, handoffPath),
+			Reason:      outcome.Reason,
+			Evidence:    outcome.Evidence,
+			ExitCode:    outcome.ExitCode,
+			HandoffPath: handoffPath,
+			Transcript:  sessionTranscript(run.Dir, workdir, sessionStart, cfg.NoHooks && !hookInstalled),
+			GitStart:    snapshot,
+		}
+		taskPlan := loadPlan(plan)
+		rec.Milestones = taskPlan.progress()
+		finishSessionRecord(run, &rec, outcome, cfg.Checkpoint)
+		run.recordSession(rec)
+		if err := writeLedger(run); err != nil {
+			errMsg("Failed to write the ledger: %v", err)
+		}
+		if interrupted {
+			logMsg("Interrupted while claude was exiting, stopping")
+			break sessionLoop
+		}
+		outcome.Status = rec.Handoff.status()
+		if outcome.Status == statusBlocked {
+			blocked++
+		} else {
+			blocked = 0
+		}
+
+		decision := decideNext(outcome, RelayState{
+			Session:     i,
+			MaxSessions: cfg.MaxSessions,
+			Crashes:     crashes,
+			Blocked:     blocked,
+			OpenPlan:    taskPlan.open(),
+			PlanBlocks:  planBlocks,
+		})
+		if isCompletion(outcome) && decision.Action != ActionStop {
+			planBlocks++
+			logMsg("Not complete yet: %s", decision.Reason)
+		} else {
+			planBlocks = 0
+		}
+		switch decision.Action {
+		case ActionStop:
+			if outcome.Status == statusBelievedDone {
+				outcome.Reason = decision.Reason
+			}
+			if outcome.Kind == OutcomeCompleted || outcome.Status == statusBelievedDone {
+				fmt.Printf("\n%s%s✓ Session %d: %s — task likely complete%s\n",
+					colorGreen, colorBold, i, outcome.Reason, colorReset)
 			} else {
-				break sessionLoop
+				logMsg("Stopping: %s", decision.Reason)
 			}
+			break sessionLoop
+		case ActionRelay:
+			prevHandoffPath = handoffPath
+		case ActionRetry:
+			logMsg("Starting a recovery session (%s)...", decision.Reason)
+			prevHandoffPath = recoveryNote(outcome, i, formatTranscriptTail(transcriptTail(rec.Transcript, 8), 1500))
 		}
+		prevSnapshot = snapshot
+		prevFiles = files
+		time.Sleep(3 * time.Second)
 	}
 
-	printFinishBanner(lastSession,
+	banner := []string{
 		"Handoff files: ls /tmp/icc-handoff-*.md",
+		fmt.Sprintf("Run history: %s", filepath.Join(run.Dir, "manifest.json")),
 		fmt.Sprintf("Attach: tmux attach -t %s", tmuxSession),
 		fmt.Sprintf("Cleanup: tmux kill-session -t %s", tmuxSession),
-	)
+	}
+	if history := run.statusHistory(); history != "" {
+		banner = append([]string{"Status: " + history}, banner...)
+	}
+	if progress := loadPlan(plan).progress(); progress != "" {
+		banner = append([]string{"Plan: " + progress}, banner...)
+	}
+	printFinishBanner(lastSession, banner...)
+}
+
+// finishSessionRecord adds the parsed handoff to rec and then, with
+// checkpoint set, the checkpoint, whose message needs the handoff's Q0.
+func finishSessionRecord(run *runManifest, rec *sessionRecord, outcome SessionOutcome, checkpoint bool) {
+	if outcome.Kind == OutcomeHandoff {
+		if data, err := os.ReadFile(rec.HandoffPath); err == nil {
+			rec.Handoff = parseHandoff(string(data))
+		}
+	}
+	if checkpoint {
+		rec.Checkpoint = checkpointSession(run, *rec)
+	}
 }
 
 func fileExists(path string) bool {
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -98,3 +99,21 @@ func TestRandomHex(t *testing.T) {
 func writeTestFile(path, content string) error {
 	return os.WriteFile(path, []byte(content), 0644)
 }
+
+func TestFinishSessionRecordCheckpointsWithQ0(t *testing.T) {
+	dir := initTestRepo(t)
+	handoffPath := filepath.Join(t.TempDir(), "handoff.md")
+	writeTestFile(handoffPath, "## Q0: State\n- Parser done, tests next.\n")
+	writeTestFile(filepath.Join(dir, "a.txt"), "one\n")
+
+	run := &runManifest{ID: "icc-test"}
+	rec := sessionRecord{Number: 1, Outcome: "handoff", HandoffPath: handoffPath}
+	finishSessionRecord(run, &rec, SessionOutcome{Kind: OutcomeHandoff}, true)
+	if rec.Handoff == nil || rec.Checkpoint == "" {
+		t.Fatalf("record = %+v, want a handoff and a checkpoint", rec)
+	}
+	msg := gitTest(t, "log", "-1", "--format=%B", rec.Checkpoint)
+	if !strings.HasPrefix(msg, "icc icc-test s1: Parser done, tests next.") {
+		t.Errorf("checkpoint message:\n%s", msg)
+	}
+}
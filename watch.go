@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchFile returns a channel that receives a value whenever path may have
+// been created or changed, and a function that stops the watch.
+// It uses filesystem notifications where the platform supports them
+// (see notifyFile) and falls back to polling otherwise.
+// Notifications are coalesced: a slow reader sees one value for many changes.
+func watchFile(path string) (<-chan struct{}, func()) {
+	if ch, stop, err := notifyFile(path); err == nil {
+		return ch, stop
+	}
+	return pollFile(path, time.Second)
+}
+
+// pollFile is the portable fallback for watchFile: it compares the file's
+// existence, size and mtime every interval.
+func pollFile(path string, interval time.Duration) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	done := make(chan struct{})
+	last := fileSignature(path)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if sig := fileSignature(path); sig != last {
+					last = sig
+					notify(ch)
+				}
+			}
+		}
+	}()
+
+	return ch, func() { close(done) }
+}
+
+// fileSignature summarizes a file's existence, size and mtime.
+func fileSignature(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(info.Size(), 10) + "@" + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+}
+
+// notify performs a non-blocking send on a coalescing notification channel.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// watchClaudeExit returns a channel that is closed once claude, running in
+// pane, has exited. It resolves the claude pid from the pane's shell and
+// watches it with signal 0, which costs a syscall rather than a tmux round
+// trip. If the pid cannot be resolved it falls back to polling the pane's
+// foreground command. The watch stops when done is closed.
+func watchClaudeExit(pane string, done <-chan struct{}) <-chan struct{} {
+	exited := make(chan struct{})
+	pid := claudePid(pane)
+
+	go func() {
+		interval := 250 * time.Millisecond
+		check := func() bool { return !processAlive(pid) }
+		if pid == 0 {
+			interval = 2 * time.Second
+			check = func() bool { return isShellForeground(pane) }
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if check() {
+					close(exited)
+					return
+				}
+			}
+		}
+	}()
+
+	return exited
+}
+
+// claudePid returns the pid of the process the pane's shell is running
+// in the foreground (claude, or the CLAUDE_BIN wrapper), or 0 if unknown.
+func claudePid(pane string) int {
+	out, err := exec.Command("tmux", "display-message", "-t", pane, "-p", "#{pane_pid}").Output()
+	if err != nil {
+		return 0
+	}
+	shellPid := strings.TrimSpace(string(out))
+	out, err = exec.Command("pgrep", "-P", shellPid).Output()
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return 0
+	}
+	pid, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// processAlive reports whether a process with the given pid exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// notifyFile watches path's parent directory with inotify and signals on
+// events that name path. Watching the directory rather than the file lets
+// us see the file being created.
+func notifyFile(path string) (<-chan struct{}, func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, err
+	}
+	const mask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+		syscall.IN_MOVED_TO | syscall.IN_DELETE
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+
+	// A non-blocking fd wrapped by os.NewFile is served by the runtime
+	// poller, so Close unblocks the pending Read below.
+	f := os.NewFile(uintptr(fd), "inotify")
+	name := filepath.Base(path)
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				start := off + syscall.SizeofInotifyEvent
+				end := start + int(ev.Len)
+				if end > n {
+					break
+				}
+				if strings.TrimRight(string(buf[start:end]), "\x00") == name {
+					notify(ch)
+				}
+				off = end
+			}
+		}
+	}()
+
+	return ch, func() { f.Close() }, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// notifyFile is only implemented with inotify; other platforms poll.
+func notifyFile(path string) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("filesystem notifications not supported on this platform")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func expectNotification(t *testing.T, ch <-chan struct{}, within time.Duration) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(within):
+		t.Fatalf("no notification within %s", within)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	t.Run("notifies on creation and change", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "handoff.md")
+		ch, stop := watchFile(path)
+		defer stop()
+
+		writeTestFile(path, "## Q0: state")
+		expectNotification(t, ch, 3*time.Second)
+
+		// Drain anything coalesced from the first write.
+		time.Sleep(50 * time.Millisecond)
+		select {
+		case <-ch:
+		default:
+		}
+
+		writeTestFile(path, "## Q0: state\n\n## Q1: next")
+		expectNotification(t, ch, 3*time.Second)
+	})
+
+	t.Run("ignores other files in the directory", func(t *testing.T) {
+		dir := t.TempDir()
+		ch, stop, err := notifyFile(filepath.Join(dir, "handoff.md"))
+		if err != nil {
+			t.Skip("filesystem notifications not supported:", err)
+		}
+		defer stop()
+
+		writeTestFile(filepath.Join(dir, "other.md"), "x")
+		select {
+		case <-ch:
+			t.Error("unexpected notification for an unrelated file")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+func TestPollFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handoff.md")
+	ch, stop := pollFile(path, 10*time.Millisecond)
+	defer stop()
+
+	writeTestFile(path, "content")
+	expectNotification(t, ch, time.Second)
+}
+
+func TestProcessAlive(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skip("cannot start sleep:", err)
+	}
+	pid := cmd.Process.Pid
+
+	if !processAlive(pid) {
+		t.Error("expected running process to be alive")
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	if processAlive(pid) {
+		t.Error("expected reaped process to be gone")
+	}
+	if processAlive(0) {
+		t.Error("pid 0 should never be reported alive")
+	}
+}